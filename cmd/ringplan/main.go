@@ -0,0 +1,135 @@
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// ringplan 预演节点的增删，打印换了节点的区间和需要移动的key的比例
+//
+// 离线计算：
+//
+//	ringplan -peers http://localhost:8001,http://localhost:8002 -add http://localhost:8003=2
+//
+// 查询运行中节点的管理接口：
+//
+//	ringplan -admin http://localhost:9998/admin -remove http://localhost:8002
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"ppcache"
+	"ppcache/consistenthash"
+	"strings"
+	"text/tabwriter"
+)
+
+//逗号分隔的列表
+func split(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+//根据名称创建哈希环
+func newRing(replicas int, hash string) (*consistenthash.Map, error) {
+	switch hash {
+	case "crc32":
+		return consistenthash.New(replicas, crc32.ChecksumIEEE), nil
+	case "fnv1a":
+		return consistenthash.New(replicas, consistenthash.FNV1a), nil
+	case "murmur3":
+		return consistenthash.New(replicas, consistenthash.Murmur3), nil
+	case "xxhash":
+		return consistenthash.New(replicas, consistenthash.XXHash), nil
+	case "xxhash64":
+		return consistenthash.New64(replicas, consistenthash.XXHash64), nil
+	}
+	return nil, fmt.Errorf("unknown hash %q", hash)
+}
+
+//离线计算变更前后的差异
+func localPlan(peers, add, remove []string, replicas int, hash string) (*consistenthash.Plan, error) {
+	ring, err := newRing(replicas, hash)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range peers {
+		peer, err := ppcache.ParsePeer(s)
+		if err != nil {
+			return nil, err
+		}
+		ring.AddWeighted(peer.Addr, peer.Weight)
+	}
+	next := ring.Clone()
+	for _, addr := range remove {
+		next.Remove(addr)
+	}
+	for _, s := range add {
+		peer, err := ppcache.ParsePeer(s)
+		if err != nil {
+			return nil, err
+		}
+		next.AddWeighted(peer.Addr, peer.Weight)
+	}
+	return ring.Diff(next)
+}
+
+//通过节点的管理接口计算差异
+func remotePlan(admin string, add, remove []string) (*consistenthash.Plan, error) {
+	q := url.Values{"add": add, "remove": remove}
+	res, err := http.Get(strings.TrimSuffix(admin, "/") + "/plan?" + q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("admin returned %s", res.Status)
+	}
+	plan := &consistenthash.Plan{}
+	return plan, json.NewDecoder(res.Body).Decode(plan)
+}
+
+func main() {
+	var peers, add, remove, admin, hash string
+	var replicas int
+	var verbose bool
+	flag.StringVar(&peers, "peers", "", "Current peers, comma separated addr or addr=weight")
+	flag.StringVar(&add, "add", "", "Peers to add, comma separated addr or addr=weight")
+	flag.StringVar(&remove, "remove", "", "Peers to remove, comma separated")
+	flag.StringVar(&admin, "admin", "", "Admin endpoint of a running node, used instead of -peers")
+	flag.IntVar(&replicas, "replicas", 50, "Virtual nodes per peer")
+	flag.StringVar(&hash, "hash", "crc32", "Hash function: crc32, fnv1a, murmur3, xxhash or xxhash64")
+	flag.BoolVar(&verbose, "v", false, "Print every moved range")
+	flag.Parse()
+
+	var plan *consistenthash.Plan
+	var err error
+	if admin != "" {
+		plan, err = remotePlan(admin, split(add), split(remove))
+	} else {
+		plan, err = localPlan(split(peers), split(add), split(remove), replicas, hash)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("%.2f%% of keys change owner\n", plan.Fraction*100)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FROM\tTO\tKEYS\tRANGES")
+	for _, mv := range plan.Moves {
+		fmt.Fprintf(w, "%s\t%s\t%.2f%%\t%d\n", mv.From, mv.To, mv.Fraction*100, len(mv.Ranges))
+		if verbose {
+			for _, r := range mv.Ranges {
+				fmt.Fprintf(w, "\t\t\t(%d, %d]\n", r.Start, r.End)
+			}
+		}
+	}
+	w.Flush()
+}
@@ -3,11 +3,22 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
 	"ppcache"
+	"ppcache/discovery"
+	"ppcache/swim"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 //模拟数据库
@@ -24,18 +35,111 @@ func createGroup() *ppcache.Group {
 			if v, ok := db[key]; ok {
 				return []byte(v), nil
 			}
-			return nil, fmt.Errorf("%s not exist", key)
+			return nil, fmt.Errorf("%s not exist: %w", key, ppcache.ErrNotFound)
 		},
 	))
 }
 
 //启动缓存服务器，创建HTTPPool 添加节点信息，注册到pp中，启动http服务
-func startCacheServer(addr string, addrs []string, pp *ppcache.Group) {
-	peers := ppcache.NewHTTPPool(addr)
-	peers.Set(addrs...)
+//gossip不为空时不使用固定的节点列表，通过gossip发现其他节点；disc不为nil时从disc获取节点列表
+//listen不为空时在listen上监听，否则在addr上监听
+//收到SIGTERM或SIGINT后优雅退出，退出前把缓存交给其他节点
+func startCacheServer(addr, listen string, addrs []string, pp *ppcache.Group, opts *ppcache.HTTPPoolOptions, gossip string, seeds []string, disc discovery.Discovery) {
+	peers := ppcache.NewHTTPPoolOpts(addr, opts)
+	//其他节点只接受签名的推送，没有配置密钥时不交出缓存
+	server := ppcache.NewServer(peers, &ppcache.ServerOptions{Handoff: len(opts.Secrets) > 0})
+	switch {
+	case disc != nil:
+		startDiscovery(peers, disc)
+	case gossip != "":
+		node := startGossip(peers, addr, gossip, seeds, opts.Secrets)
+		server.OnLeave(func(ctx context.Context) error {
+			return node.Leave()
+		})
+	default:
+		peers.Set(addrs...)
+	}
 	pp.RegisterPeers(peers)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	served := make(chan error, 1)
+	go func() {
+		if listen == "" {
+			served <- server.ListenAndServe()
+			return
+		}
+		l, err := net.Listen("tcp", listen)
+		if err != nil {
+			served <- err
+			return
+		}
+		served <- server.Serve(l)
+	}()
 	log.Println("ppCache is running at", addr)
-	log.Fatal(http.ListenAndServe(addr[7:], peers))
+	select {
+	case err := <-served:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	log.Println("ppCache is shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("shutdown:", err)
+	}
+	<-served
+}
+
+//启动gossip，节点加入和离开时自动更新哈希环，gossip消息使用与节点间请求相同的密钥签名
+func startGossip(pool *ppcache.HTTPPool, addr, bind string, seeds []string, secrets [][]byte) *swim.Node {
+	node, err := swim.Start(swim.Config{
+		Name:     addr,
+		BindAddr: bind,
+		OnChange: swim.UpdatePool(pool),
+		Secrets:  secrets,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(seeds) > 0 {
+		if _, err := node.Join(seeds...); err != nil {
+			log.Println("joining cluster:", err)
+		}
+	}
+	log.Println("gossip is running at", node.LocalAddr())
+	return node
+}
+
+//持续从disc同步节点列表，首次获取失败时退出
+func startDiscovery(pool *ppcache.HTTPPool, disc discovery.Discovery) {
+	ch, err := disc.Watch(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	discovery.Apply(pool, <-ch)
+	go func() {
+		for peers := range ch {
+			discovery.Apply(pool, peers)
+		}
+	}()
+}
+
+//解析-dns参数，name:port查询A/AAAA记录，只有name时查询SRV记录
+func dnsDiscovery(target, scheme string) (discovery.Discovery, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		d := discovery.NewSRV(target)
+		d.Scheme = scheme
+		return d, nil
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, fmt.Errorf("bad port in %q: %v", target, err)
+	}
+	d := discovery.NewHost(host, p)
+	d.Scheme = scheme
+	return d, nil
 }
 
 //启动一个api服务 和用户交互
@@ -45,28 +149,65 @@ func startAPIServer(apiAddr string, pp *ppcache.Group) {
 			key := r.URL.Query().Get("key")
 			view, err := pp.Get(key)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				http.Error(w, err.Error(), ppcache.StatusCode(err))
 				return
 			}
 			w.Header().Set("Content-Type", "application/octet-stream")
 			w.Write(view.ByteSlice())
 		}))
 	log.Println("fontend server is running at", apiAddr)
-	log.Fatal(http.ListenAndServe(apiAddr[7:], nil))
+	u, err := url.Parse(apiAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Fatal(http.ListenAndServe(u.Host, nil))
 }
 
 func main() {
 	var port int
 	var api bool
+	var certFile, keyFile, caFile string
+	var mtls bool
+	var secret string
+	var gossip, join string
+	var dns, advertise string
+	var replication int
 	flag.IntVar(&port, "port", 8001, "PPcache server port")
 	flag.BoolVar(&api, "api", false, "Start a api server")
+	flag.StringVar(&certFile, "cert", "", "TLS certificate file, enables https between peers")
+	flag.StringVar(&keyFile, "key", "", "TLS private key file")
+	flag.StringVar(&caFile, "ca", "", "CA file used to verify peer certificates")
+	flag.BoolVar(&mtls, "mtls", false, "Require client certificates from peers")
+	flag.StringVar(&secret, "secret", "", "Shared secret used to sign requests between peers")
+	flag.StringVar(&gossip, "gossip", "", "UDP address for gossip membership, e.g. :7946, replaces the static peer list")
+	flag.StringVar(&join, "join", "", "Comma separated gossip addresses of seed nodes")
+	flag.IntVar(&replication, "replication", 1, "Number of nodes that keep a copy of each loaded value")
+	flag.StringVar(&dns, "dns", "", "Discover peers through DNS: an SRV name, or host:port to resolve A/AAAA records")
+	flag.StringVar(&advertise, "advertise", "", "Address other peers use to reach this node, e.g. http://10.0.0.2:8001, required with -dns")
 	flag.Parse()
 
+	scheme := "http"
+	opts := &ppcache.HTTPPoolOptions{}
+	if certFile != "" {
+		scheme = "https"
+		opts.TLS = &ppcache.TLSOptions{
+			CertFile:       certFile,
+			KeyFile:        keyFile,
+			CAFile:         caFile,
+			ClientAuth:     mtls,
+			ReloadInterval: time.Minute,
+		}
+	}
+
+	if secret != "" {
+		opts.Secrets = [][]byte{[]byte(secret)}
+	}
+
 	apiAddr := "http://localhost:9999"
 	addrMap := map[int]string{
-		8001: "http://localhost:8001",
-		8002: "http://localhost:8002",
-		8003: "http://localhost:8003",
+		8001: scheme + "://localhost:8001",
+		8002: scheme + "://localhost:8002",
+		8003: scheme + "://localhost:8003",
 	}
 
 	var addrs []string
@@ -74,11 +215,37 @@ func main() {
 		addrs = append(addrs, v)
 	}
 
+	if replication > 1 && secret == "" {
+		log.Fatal("-replication requires -secret, replicas only accept signed pushes")
+	}
 	pp := createGroup()
+	pp.SetReplication(replication)
 	if api {
 		go startAPIServer(apiAddr, pp)
 	}
-	startCacheServer(addrMap[port], []string(addrs), pp)
+	var seeds []string
+	for _, seed := range strings.Split(join, ",") {
+		if seed != "" {
+			seeds = append(seeds, seed)
+		}
+	}
+	//通过DNS发现节点时，自己的地址必须与DNS记录中的一致，否则会把自己当成另一个节点
+	self, listen := addrMap[port], ""
+	if advertise != "" {
+		self, listen = advertise, fmt.Sprintf(":%d", port)
+	}
+	var disc discovery.Discovery
+	if dns != "" {
+		if advertise == "" {
+			log.Fatal("-dns requires -advertise, the address of this node as it appears in DNS")
+		}
+		d, err := dnsDiscovery(dns, scheme)
+		if err != nil {
+			log.Fatal(err)
+		}
+		disc = d
+	}
+	startCacheServer(self, listen, []string(addrs), pp, opts, gossip, seeds, disc)
 }
 
 //func main() {
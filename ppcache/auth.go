@@ -0,0 +1,191 @@
+// Package ppcache
+// @author    : MuXiang123
+// @time      : 2026/10/19 12:40
+// 节点间请求的HMAC签名，防止未授权的访问和重放
+package ppcache
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	headerTimestamp = "X-Ppcache-Timestamp" //签名时间，unix秒
+	headerNonce     = "X-Ppcache-Nonce"     //每个请求唯一的随机串
+	headerSignature = "X-Ppcache-Signature" //hex编码的HMAC-SHA256
+	headerBodyHash  = "X-Ppcache-Body-Hash" //hex编码的请求体SHA-256，签名覆盖它，验签后再与请求体比较
+
+	maxSignedBody = maxBulkBody //验签时最多读取的请求体，超过的请求直接拒绝
+
+	defaultMaxClockSkew = 30 * time.Second //默认允许的时钟偏差
+)
+
+var (
+	errMissingSignature = errors.New("ppcache: missing request signature")
+	errStaleSignature   = errors.New("ppcache: request timestamp out of range")
+	errBadSignature     = errors.New("ppcache: invalid request signature")
+	errReplayed         = errors.New("ppcache: replayed request")
+	errBodyTooLarge     = errors.New("ppcache: request body too large")
+)
+
+//签名覆盖的协议请求头，转发次数、哈希环指纹等都会影响接收方的处理
+var signedHeaders = []string{hopsHeader, ringHeader, cachedOnlyHeader, askingHeader}
+
+//使用共享密钥对请求签名和验签
+type authenticator struct {
+	secrets [][]byte      //第一个密钥用于签名，所有密钥都可以通过验签，用于密钥轮换
+	skew    time.Duration //允许的时钟偏差，同时也是nonce的保存时间
+	now     func() time.Time
+
+	mu     sync.Mutex
+	nonces map[string]time.Time //时间窗口内见过的nonce及其过期时间
+	pruned time.Time            //上一次清理过期nonce的时间
+}
+
+func newAuthenticator(secrets [][]byte, skew time.Duration) *authenticator {
+	if skew <= 0 {
+		skew = defaultMaxClockSkew
+	}
+	return &authenticator{
+		secrets: secrets,
+		skew:    skew,
+		now:     time.Now,
+		nonces:  make(map[string]time.Time),
+	}
+}
+
+//签名内容为 method\npath\nquery\ntimestamp\nnonce\nbody hash，之后是signedHeaders中每个请求头的值
+func signature(secret []byte, r *http.Request, ts, nonce, bodyHash string) []byte {
+	var b strings.Builder
+	for _, v := range []string{r.Method, r.URL.EscapedPath(), r.URL.RawQuery, ts, nonce, bodyHash} {
+		b.WriteString(v)
+		b.WriteByte('\n')
+	}
+	for _, h := range signedHeaders {
+		b.WriteString(r.Header.Get(h))
+		b.WriteByte('\n')
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(b.String()))
+	return mac.Sum(nil)
+}
+
+//请求体的SHA-256，读取后把请求体换成可以重复读取的副本
+func hashBody(req *http.Request) (string, error) {
+	var body []byte
+	var err error
+	switch {
+	case req.GetBody != nil:
+		var rc io.ReadCloser
+		if rc, err = req.GetBody(); err != nil {
+			return "", err
+		}
+		body, err = io.ReadAll(rc)
+		rc.Close()
+	case req.Body != nil && req.Body != http.NoBody:
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// sign 为请求添加签名相关的请求头，需要在设置好其他请求头之后调用
+func (a *authenticator) sign(req *http.Request) error {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	bodyHash, err := hashBody(req)
+	if err != nil {
+		return err
+	}
+	nonce := hex.EncodeToString(b)
+	ts := strconv.FormatInt(a.now().Unix(), 10)
+	sig := signature(a.secrets[0], req, ts, nonce, bodyHash)
+	req.Header.Set(headerTimestamp, ts)
+	req.Header.Set(headerNonce, nonce)
+	req.Header.Set(headerBodyHash, bodyHash)
+	req.Header.Set(headerSignature, hex.EncodeToString(sig))
+	return nil
+}
+
+// verify 校验请求的签名，并拒绝时间窗口外或者重复的请求
+func (a *authenticator) verify(r *http.Request) error {
+	ts, nonce, bodyHash := r.Header.Get(headerTimestamp), r.Header.Get(headerNonce), r.Header.Get(headerBodyHash)
+	sig, err := hex.DecodeString(r.Header.Get(headerSignature))
+	if ts == "" || nonce == "" || bodyHash == "" || err != nil || len(sig) == 0 {
+		return errMissingSignature
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errMissingSignature
+	}
+	now := a.now()
+	signedAt := time.Unix(sec, 0)
+	if signedAt.Before(now.Add(-a.skew)) || signedAt.After(now.Add(a.skew)) {
+		return errStaleSignature
+	}
+	valid := false
+	for _, secret := range a.secrets {
+		if hmac.Equal(sig, signature(secret, r, ts, nonce, bodyHash)) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return errBadSignature
+	}
+	//签名有效后再记录nonce，避免伪造的请求占用内存
+	if err = a.useNonce(nonce, signedAt, now); err != nil {
+		return err
+	}
+	//签名有效后再读取请求体，与签名中的摘要比较，之后的处理读到的是已经校验过的副本
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSignedBody+1))
+	if err != nil {
+		return errBadSignature
+	}
+	if len(body) > maxSignedBody {
+		return errBodyTooLarge
+	}
+	sum := sha256.Sum256(body)
+	if !hmac.Equal([]byte(hex.EncodeToString(sum[:])), []byte(bodyHash)) {
+		return errBadSignature
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return nil
+}
+
+//记录nonce，时间窗口内重复出现时返回errReplayed
+func (a *authenticator) useNonce(nonce string, signedAt, now time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if now.Sub(a.pruned) > a.skew {
+		for n, expire := range a.nonces {
+			if now.After(expire) {
+				delete(a.nonces, n)
+			}
+		}
+		a.pruned = now
+	}
+	if _, ok := a.nonces[nonce]; ok {
+		return errReplayed
+	}
+	//时间戳超出窗口的请求已经被拒绝，nonce只需要保存到窗口结束
+	a.nonces[nonce] = signedAt.Add(a.skew)
+	return nil
+}
@@ -0,0 +1,72 @@
+// Package ppcache
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:59
+// 有界负载：首选节点上未完成的请求过多时把请求交给环上的下一个节点
+package ppcache
+
+import (
+	"context"
+	pb "ppcache/ppcachepb"
+	"sync"
+)
+
+//支持有界负载的节点选择算法，consistenthash.Map开启有界负载模式后实现这个接口
+type boundedPicker interface {
+	Acquire(key string) (string, bool)
+	Release(node string)
+}
+
+//有界负载模式下PickPeer返回的客户端，请求结束后释放节点的负载
+//选中的不是首选节点时要求对方直接处理，不再转发回首选节点
+type boundedGetter struct {
+	*httpGetter
+	spill   bool
+	release func()
+	once    sync.Once
+}
+
+func (g *boundedGetter) Get(in *pb.Request, out *pb.Response) error {
+	return g.GetContext(context.Background(), in, out)
+}
+
+func (g *boundedGetter) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	defer g.once.Do(g.release)
+	if g.spill {
+		ctx = withAsking(ctx)
+	}
+	return g.httpGetter.GetContext(ctx, in, out)
+}
+
+//按有界负载选择节点，没有开启有界负载时返回false，调用方需要持有p.mu
+func (p *HTTPPool) pickBounded(key string) (PeerGetter, bool, bool) {
+	picker, ok := p.peers.(boundedPicker)
+	if !ok || p.opts.BoundedLoad <= 0 || p.opts.ReadReplicas > 1 {
+		return nil, false, false
+	}
+	node, ok := picker.Acquire(key)
+	if !ok {
+		return nil, false, false
+	}
+	getter, ok := p.httpGetter[node]
+	if node == p.self || !ok {
+		picker.Release(node)
+		return nil, false, true
+	}
+	return &boundedGetter{
+		httpGetter: getter,
+		spill:      node != p.peers.Get(key),
+		release:    func() { picker.Release(node) },
+	}, true, true
+}
+
+//请求方指定由对方处理，即使对方还不是key的owner也直接加载，保存在context中由httpGetter转为请求头
+type askingKey struct{}
+
+func withAsking(ctx context.Context) context.Context {
+	return context.WithValue(ctx, askingKey{}, true)
+}
+
+func ctxAsking(ctx context.Context) bool {
+	ask, _ := ctx.Value(askingKey{}).(bool)
+	return ask
+}
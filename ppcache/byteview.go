@@ -3,9 +3,18 @@
 // @time      : 2022/7/27 18:29
 package ppcache
 
+import (
+	pb "ppcache/ppcachepb"
+	"time"
+)
+
 // ByteView 保存字节不可变的view
 type ByteView struct {
-	b []byte // 存储真正的缓存值，byte类型能支持任意数据类型的存储
+	b       []byte    // 存储真正的缓存值，byte类型能支持任意数据类型的存储
+	expire  time.Time // 过期时间，零值表示永不过期
+	created time.Time // 在owner节点上加载的时间
+	version uint64    // 值的版本
+	flags   uint32    // 附加标记
 }
 
 // Length 返回view的长度
@@ -30,3 +39,63 @@ func cloneBytes(b []byte) []byte {
 func (v ByteView) String() string {
 	return string(v.b)
 }
+
+// Expire 返回过期时间，零值表示永不过期
+func (v ByteView) Expire() time.Time {
+	return v.expire
+}
+
+// CreatedAt 返回值在owner节点上加载的时间
+func (v ByteView) CreatedAt() time.Time {
+	return v.created
+}
+
+// Version 返回值的版本
+func (v ByteView) Version() uint64 {
+	return v.version
+}
+
+// Flags 返回附加标记
+func (v ByteView) Flags() uint32 {
+	return v.flags
+}
+
+//判断在now时刻是否已经过期
+func (v ByteView) expired(now time.Time) bool {
+	return !v.expire.IsZero() && !now.Before(v.expire)
+}
+
+//unix纳秒和time.Time互转，0对应零值
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+//把值和元数据写入响应
+func (v ByteView) toResponse(res *pb.Response) {
+	res.Value = v.ByteSlice()
+	res.ExpireAt = unixNano(v.expire)
+	res.CreatedAt = unixNano(v.created)
+	res.Version = v.version
+	res.Flags = v.flags
+}
+
+//从响应中还原值和元数据
+func viewFromResponse(res *pb.Response) ByteView {
+	return ByteView{
+		b:       res.Value,
+		expire:  fromUnixNano(res.ExpireAt),
+		created: fromUnixNano(res.CreatedAt),
+		version: res.Version,
+		flags:   res.Flags,
+	}
+}
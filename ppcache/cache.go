@@ -6,6 +6,7 @@ package ppcache
 import (
 	"ppcache/lru"
 	"sync"
+	"time"
 )
 
 //缓存操作实体，解决并发问题
@@ -26,6 +27,39 @@ func (c *cache) add(key string, value ByteView) {
 	c.lru.Add(key, value)
 }
 
+//线程安全，从缓存中删除key
+func (c *cache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru != nil {
+		c.lru.Remove(key)
+	}
+}
+
+//缓存中的一个值
+type cacheEntry struct {
+	key   string
+	value ByteView
+}
+
+//按最近访问的顺序返回最多n个未过期的值，n<=0时返回全部
+func (c *cache) entries(n int) []cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return nil
+	}
+	now := time.Now()
+	var list []cacheEntry
+	c.lru.Range(func(key string, value lru.Value) bool {
+		if v := value.(ByteView); !v.expired(now) {
+			list = append(list, cacheEntry{key: key, value: v})
+		}
+		return n <= 0 || len(list) < n
+	})
+	return list
+}
+
 //线程安全
 func (c *cache) get(key string) (value ByteView, ok bool) {
 	c.mu.Lock()
@@ -34,6 +68,11 @@ func (c *cache) get(key string) (value ByteView, ok bool) {
 		return
 	}
 	if v, ok := c.lru.Get(key); ok {
+		//过期的值直接删除，当作未命中
+		if v.(ByteView).expired(time.Now()) {
+			c.lru.Remove(key)
+			return ByteView{}, false
+		}
 		return v.(ByteView), ok
 	}
 	return
@@ -0,0 +1,119 @@
+// Package consistenthash
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// 有界负载的一致性哈希：每个节点最多承担平均负载的(1+ε)倍，超出时顺时针跳到下一个节点
+package consistenthash
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+//有界负载模式下各节点的负载
+type loads struct {
+	mu      sync.Mutex
+	epsilon float64          //允许超出平均负载的比例
+	load    map[string]int64 //节点当前的负载
+	total   int64            //所有节点的负载之和
+}
+
+// NewBounded 创建有界负载模式的map，epsilon为允许超出平均负载的比例，例如0.25
+// 负载通过Acquire和Release统计，Get仍然返回不考虑负载的节点
+func NewBounded(replicas int, epsilon float64, fn Hash) *Map {
+	m := New(replicas, fn)
+	m.SetBoundedLoad(epsilon)
+	return m
+}
+
+// SetBoundedLoad 为已有的map开启有界负载模式，例如New64创建的64位哈希环，需要在使用之前调用
+func (m *Map) SetBoundedLoad(epsilon float64) {
+	m.loads = &loads{
+		epsilon: epsilon,
+		load:    make(map[string]int64),
+	}
+}
+
+//节点当前允许的最大负载，计入即将分配的这一个
+//上限按节点的虚拟节点数占比分配，权重大的节点可以承担更多负载
+func (l *loads) maxLoad(v *values, node string) int64 {
+	var vnodes int
+	for _, n := range v.nodes {
+		vnodes += n
+	}
+	if vnodes == 0 {
+		return 0
+	}
+	share := float64(v.nodes[node]) / float64(vnodes)
+	return int64(math.Ceil(float64(l.total+1) * share * (1 + l.epsilon)))
+}
+
+// Acquire 为key选择一个未超出负载上限的节点并增加其负载，使用完后需要调用Release
+// 首选节点超出上限时顺时针查找下一个节点；没有节点或者不是有界负载模式时返回false
+func (m *Map) Acquire(key string) (string, bool) {
+	if m.loads == nil {
+		return "", false
+	}
+	values := m.loadValues()
+	if len(values.keys) == 0 {
+		return "", false
+	}
+	hash := m.sum([]byte(m.tag.Extract(key)))
+	idx := sort.Search(len(values.keys), func(i int) bool {
+		return values.keys[i] >= hash
+	})
+
+	l := m.loads
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := 0; i < len(values.keys); i++ {
+		node := values.hashMap[values.keys[(idx+i)%len(values.keys)]]
+		if l.load[node]+1 <= l.maxLoad(values, node) {
+			l.load[node]++
+			l.total++
+			return node, true
+		}
+	}
+	//所有节点的上限之和不小于负载之和，正常情况下不会走到这里
+	node := values.hashMap[values.keys[idx%len(values.keys)]]
+	l.load[node]++
+	l.total++
+	return node, true
+}
+
+// Release 请求结束后减少节点的负载
+func (m *Map) Release(node string) {
+	if m.loads == nil {
+		return
+	}
+	l := m.loads
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.load[node] > 0 {
+		l.load[node]--
+		l.total--
+	}
+	if l.load[node] == 0 {
+		delete(l.load, node)
+	}
+}
+
+// Load 返回节点当前的负载
+func (m *Map) Load(node string) int64 {
+	if m.loads == nil {
+		return 0
+	}
+	m.loads.mu.Lock()
+	defer m.loads.mu.Unlock()
+	return m.loads.load[node]
+}
+
+// MaxLoad 返回下一次Acquire时node允许的最大负载，与节点的权重成正比
+func (m *Map) MaxLoad(node string) int64 {
+	if m.loads == nil {
+		return 0
+	}
+	m.loads.mu.Lock()
+	defer m.loads.mu.Unlock()
+	return m.loads.maxLoad(m.loadValues(), node)
+}
@@ -18,13 +18,19 @@ type Hash func(data []byte) uint32
 type Map struct {
 	sync.Mutex
 	hash     Hash         //哈希函数
+	hash64   Hash64       //64位哈希函数，不为nil时使用64位的哈希环
 	replicas int          //虚拟节点倍数
 	values   atomic.Value //原子的存取keys和hashMap
+	loads    *loads       //有界负载模式下各节点的负载，普通模式为nil
+	tag      HashTag      //key中参与哈希的部分，零值表示使用整个key
 }
 
 type values struct {
-	keys    []int          // 哈希环
+	keys    []int          // 哈希环，每个哈希值只出现一次
 	hashMap map[int]string //虚拟节点和真实节点的映射表，key为虚拟节点，value为真实节点
+	nodes   map[string]int //真实节点和它的虚拟节点数
+	//多个虚拟节点哈希相同时，名称最小的真实节点占用该位置，其余的记录在这里，删除占用者时依次补位
+	collisions map[int][]string
 }
 
 // New 创建一个map实例 允许自定义虚拟节点倍数和hash函数
@@ -34,7 +40,9 @@ func New(replicas int, fn Hash) *Map {
 		hash:     fn,
 	}
 	m.values.Store(&values{
-		hashMap: make(map[int]string),
+		hashMap:    make(map[int]string),
+		nodes:      make(map[string]int),
+		collisions: make(map[int][]string),
 	})
 	if m.hash == nil {
 		//生成hashcode的默认算法
@@ -43,26 +51,90 @@ func New(replicas int, fn Hash) *Map {
 	return m
 }
 
+// New64 创建使用64位哈希环的map，虚拟节点多时冲突更少，fn为nil时使用XXHash64
+// 环上的位置保存在int中，因此只能在64位平台上使用
+func New64(replicas int, fn Hash64) *Map {
+	if strconv.IntSize != 64 {
+		panic("consistenthash: 64-bit ring requires a 64-bit platform")
+	}
+	if fn == nil {
+		fn = XXHash64
+	}
+	m := New(replicas, nil)
+	m.hash64 = fn
+	return m
+}
+
+// SetHashTag 设置hash tag，标记相同的key落在同一个节点上，需要在使用之前调用
+func (m *Map) SetHashTag(tag HashTag) {
+	m.tag = tag
+}
+
+//计算数据在环上的位置，64位的哈希值转换为int后顺序会整体旋转，但仍然是一个环
+func (m *Map) sum(data []byte) int {
+	if m.hash64 != nil {
+		return int(m.hash64(data))
+	}
+	return int(m.hash(data))
+}
+
 // Add 传入0个或多个真实节点的名称
 func (m *Map) Add(keys ...string) {
 	m.Lock()
 	defer m.Unlock()
-	newValues := m.loadValues()
+	newValues := m.copyValues()
 	for _, key := range keys {
-		// 对每个 key(节点) 创建 m.replicas 个虚拟节点
-		for i := 0; i < m.replicas; i++ {
-			//生成虚拟节点的hash
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			//添加到环上
-			newValues.keys = append(newValues.keys, hash)
-			newValues.hashMap[hash] = key
-		}
+		m.add(newValues, key, 1)
 	}
 	//对key排序
 	sort.Ints(newValues.keys)
 	m.values.Store(newValues)
 }
 
+// AddWeighted 添加一个带权重的真实节点，虚拟节点数为 replicas*weight，weight小于1时按1处理
+// 节点已经存在时按新的权重重新添加
+func (m *Map) AddWeighted(key string, weight int) {
+	m.Lock()
+	defer m.Unlock()
+	newValues := m.copyValues()
+	m.add(newValues, key, weight)
+	sort.Ints(newValues.keys)
+	m.values.Store(newValues)
+}
+
+//在values上添加节点的虚拟节点，调用方负责排序
+func (m *Map) add(v *values, key string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	//已经存在的节点先删除旧的虚拟节点，删除依赖有序的keys
+	if _, ok := v.nodes[key]; ok {
+		sort.Ints(v.keys)
+		m.remove(v, key)
+	}
+	// 对每个 key(节点) 创建 m.replicas*weight 个虚拟节点
+	n := m.replicas * weight
+	for i := 0; i < n; i++ {
+		//生成虚拟节点的hash
+		hash := m.sum([]byte(strconv.Itoa(i) + key))
+		owner, ok := v.hashMap[hash]
+		if !ok {
+			//添加到环上
+			v.keys = append(v.keys, hash)
+			v.hashMap[hash] = key
+			continue
+		}
+		//哈希冲突时让名称较小的节点占用，结果与添加顺序无关
+		if key < owner {
+			v.hashMap[hash] = key
+			v.collisions[hash] = append(v.collisions[hash], owner)
+		} else {
+			v.collisions[hash] = append(v.collisions[hash], key)
+		}
+	}
+	v.nodes[key] = n
+}
+
 // Get 传入缓存的key，返回真实节点
 func (m *Map) Get(key string) string {
 	values := m.loadValues()
@@ -70,7 +142,7 @@ func (m *Map) Get(key string) string {
 		return ""
 	}
 	//计算key的hash值
-	hash := int(m.hash([]byte(key)))
+	hash := m.sum([]byte(m.tag.Extract(key)))
 	//顺时针找到第一个匹配虚拟节点的下标
 	idx := sort.Search(len(values.keys), func(i int) bool {
 		//返回最小索引的前提条件
@@ -82,17 +154,90 @@ func (m *Map) Get(key string) string {
 	return values.hashMap[values.keys[idx%len(values.keys)]]
 }
 
+// GetN 返回从key的位置开始顺时针遇到的前n个不同的真实节点，第一个与Get的结果相同
+// 真实节点不足n个时返回全部节点
+func (m *Map) GetN(key string, n int) []string {
+	values := m.loadValues()
+	if len(values.keys) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(values.nodes) {
+		n = len(values.nodes)
+	}
+	hash := m.sum([]byte(m.tag.Extract(key)))
+	idx := sort.Search(len(values.keys), func(i int) bool {
+		return values.keys[i] >= hash
+	})
+	nodes := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	//最多绕环一圈，同一个真实节点的多个虚拟节点只取第一个
+	for i := 0; i < len(values.keys) && len(nodes) < n; i++ {
+		node := values.hashMap[values.keys[(idx+i)%len(values.keys)]]
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
 // Remove 用于删除keys和map上的节点及其虚拟节点
 func (m *Map) Remove(key string) {
 	m.Lock()
 	defer m.Unlock()
-	newValues := m.loadValues()
+	//与Add相同，在副本上修改后整体替换，并发的Get看到的始终是完整的环
+	newValues := m.copyValues()
+	m.remove(newValues, key)
+	m.values.Store(newValues)
+}
+
+//从values上删除节点的所有虚拟节点
+func (m *Map) remove(v *values, key string) {
+	n, ok := v.nodes[key]
+	if !ok {
+		return
+	}
+	for i := 0; i < n; i++ {
+		hash := m.sum([]byte(strconv.Itoa(i) + key))
+		if v.hashMap[hash] != key {
+			//只是冲突列表中的一员，从列表中删除即可
+			v.removeCollision(hash, key)
+			continue
+		}
+		if others := v.collisions[hash]; len(others) > 0 {
+			//由冲突列表中名称最小的节点补位
+			min := 0
+			for j := range others {
+				if others[j] < others[min] {
+					min = j
+				}
+			}
+			v.hashMap[hash] = others[min]
+			v.removeCollision(hash, others[min])
+			continue
+		}
+		idx := sort.SearchInts(v.keys, hash)
+		if idx < len(v.keys) && v.keys[idx] == hash {
+			v.keys = append(v.keys[:idx], v.keys[idx+1:]...)
+		}
+		delete(v.hashMap, hash)
+	}
+	delete(v.nodes, key)
+}
 
-	for i := 0; i < m.replicas; i++ {
-		hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-		idx := sort.SearchInts(newValues.keys, hash)
-		newValues.keys = append(newValues.keys[:idx], newValues.keys[idx+1:]...)
-		delete(newValues.hashMap, hash)
+//从冲突列表中删除一个节点
+func (v *values) removeCollision(hash int, key string) {
+	others := v.collisions[hash]
+	for j := range others {
+		if others[j] == key {
+			others = append(others[:j], others[j+1:]...)
+			break
+		}
+	}
+	if len(others) == 0 {
+		delete(v.collisions, hash)
+	} else {
+		v.collisions[hash] = others
 	}
 }
 
@@ -104,12 +249,20 @@ func (m *Map) loadValues() *values {
 func (m *Map) copyValues() *values {
 	oldValues := m.loadValues()
 	newValues := &values{
-		keys:    make([]int, len(oldValues.keys)),
-		hashMap: make(map[int]string),
+		keys:       make([]int, len(oldValues.keys)),
+		hashMap:    make(map[int]string),
+		nodes:      make(map[string]int, len(oldValues.nodes)),
+		collisions: make(map[int][]string, len(oldValues.collisions)),
 	}
 	copy(newValues.keys, oldValues.keys)
 	for k, v := range oldValues.hashMap {
 		newValues.hashMap[k] = v
 	}
+	for k, v := range oldValues.nodes {
+		newValues.nodes[k] = v
+	}
+	for k, v := range oldValues.collisions {
+		newValues.collisions[k] = append([]string(nil), v...)
+	}
 	return newValues
 }
@@ -4,6 +4,9 @@
 package consistenthash
 
 import (
+	"hash/crc32"
+	"math"
+	"reflect"
 	"strconv"
 	"testing"
 )
@@ -47,3 +50,301 @@ func TestHashing(t *testing.T) {
 	}
 
 }
+
+func TestAddWeighted(t *testing.T) {
+	hash := New(50, nil)
+	hash.AddWeighted("small", 1)
+	hash.AddWeighted("large", 4)
+
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		counts[hash.Get("key"+strconv.Itoa(i))]++
+	}
+	//权重为4的节点应该承担明显更多的key
+	if counts["large"] < 2*counts["small"] {
+		t.Errorf("weighted node got %d keys, small node got %d", counts["large"], counts["small"])
+	}
+
+	//重新设置权重不会留下旧的虚拟节点
+	hash.AddWeighted("large", 1)
+	if n := len(hash.loadValues().keys); n != 100 {
+		t.Errorf("expected 100 virtual nodes after reweighting, got %d", n)
+	}
+	hash.Remove("large")
+	for i := 0; i < 100; i++ {
+		if got := hash.Get("key" + strconv.Itoa(i)); got != "small" {
+			t.Fatalf("expected all keys on small after removing large, got %s", got)
+		}
+	}
+}
+
+func TestBoundedLoad(t *testing.T) {
+	hash := NewBounded(50, 0.25, nil)
+	hash.Add("a", "b", "c", "d")
+
+	//同一个热点key反复请求，负载会被分摊到其他节点
+	owner := hash.Get("hot")
+	var acquired []string
+	for i := 0; i < 100; i++ {
+		node, _ := hash.Acquire("hot")
+		acquired = append(acquired, node)
+		limit := int64(math.Ceil(float64(i+1) / 4 * 1.25))
+		if hash.Load(node) > limit {
+			t.Fatalf("node %s load %d exceeds bound %d", node, hash.Load(node), limit)
+		}
+	}
+	if hash.Load(owner) == 100 {
+		t.Fatal("all requests landed on the primary owner")
+	}
+	for _, node := range []string{"a", "b", "c", "d"} {
+		if hash.Load(node) > 32 {
+			t.Errorf("node %s load %d exceeds ceil(25*1.25)", node, hash.Load(node))
+		}
+	}
+
+	//释放后负载归零，首选节点重新可用
+	for _, node := range acquired {
+		hash.Release(node)
+	}
+	if got, _ := hash.Acquire("hot"); got != owner {
+		t.Errorf("expected primary owner %s when idle, got %s", owner, got)
+	}
+
+	//普通模式的map不会panic
+	if _, ok := New(50, nil).Acquire("hot"); ok {
+		t.Error("Acquire on a map without bounded load should return false")
+	}
+}
+
+func TestBoundedLoadWeighted(t *testing.T) {
+	hash := NewBounded(50, 0.25, nil)
+	hash.AddWeighted("big", 3)
+	hash.AddWeighted("small", 1)
+	for i := 0; i < 400; i++ {
+		hash.Acquire("key" + strconv.Itoa(i))
+	}
+	//上限按权重分配：big最多承担3/4，small最多承担1/4，各自再乘以1.25
+	if big, small := hash.Load("big"), hash.Load("small"); big > 375 || small > 125 || big < 3*small/2 {
+		t.Fatalf("loads big=%d small=%d do not follow the weights", big, small)
+	}
+	if hash.MaxLoad("big") <= 2*hash.MaxLoad("small") {
+		t.Fatalf("MaxLoad big=%d small=%d should follow the weights", hash.MaxLoad("big"), hash.MaxLoad("small"))
+	}
+}
+
+func TestGetN(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	// 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+
+	testCases := []struct {
+		key  string
+		n    int
+		want []string
+	}{
+		{"11", 2, []string{"2", "4"}},
+		{"23", 3, []string{"4", "6", "2"}},
+		{"27", 1, []string{"2"}},
+		{"27", 5, []string{"2", "4", "6"}}, //真实节点不足n个
+		{"5", 0, nil},
+	}
+	for _, tc := range testCases {
+		if got := hash.GetN(tc.key, tc.n); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("GetN(%s, %d) = %v, want %v", tc.key, tc.n, got, tc.want)
+		}
+	}
+	if got := New(3, nil).GetN("key", 2); got != nil {
+		t.Errorf("GetN on empty map = %v", got)
+	}
+}
+
+func TestVirtualNodeCollision(t *testing.T) {
+	//节点a和b的第一个虚拟节点哈希相同
+	hash := New(2, func(key []byte) uint32 {
+		switch string(key) {
+		case "0a", "0b":
+			return 10
+		case "1a":
+			return 20
+		case "1b":
+			return 30
+		}
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	hash.Add("b", "a")
+	if n := len(hash.loadValues().keys); n != 3 {
+		t.Fatalf("expected 3 distinct ring positions, got %d", n)
+	}
+	//冲突位置归名称较小的节点，与添加顺序无关
+	if got := hash.Get("5"); got != "a" {
+		t.Errorf("Get(5) = %s, want a", got)
+	}
+	if got := hash.GetN("5", 3); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("GetN(5, 3) = %v, want [a b]", got)
+	}
+
+	//删除a后，b补上冲突的位置
+	hash.Remove("a")
+	if got := hash.Get("5"); got != "b" {
+		t.Errorf("after removing a, Get(5) = %s, want b", got)
+	}
+	hash.Remove("b")
+	if n := len(hash.loadValues().keys); n != 0 {
+		t.Errorf("expected empty ring, %d positions left", n)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	// 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+	next := hash.Clone()
+	// Adds 8, 18, 28
+	next.Add("8")
+	if hash.Get("27") != "2" {
+		t.Fatal("changing the clone must not change the original ring")
+	}
+
+	plan, err := hash.Diff(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Move{{
+		From:     "2",
+		To:       "8",
+		Ranges:   []Range{{6, 8}, {16, 18}, {26, 28}},
+		Fraction: 6 / math.Exp2(32),
+	}}
+	if !reflect.DeepEqual(plan.Moves, want) {
+		t.Fatalf("Diff moves = %+v, want %+v", plan.Moves, want)
+	}
+	if plan.Fraction != 6/math.Exp2(32) {
+		t.Errorf("Diff fraction = %v", plan.Fraction)
+	}
+}
+
+func TestDiffMatchesKeyMovement(t *testing.T) {
+	hash := New(50, nil)
+	hash.Add("a", "b", "c", "d")
+	next := hash.Clone()
+	next.Remove("b")
+	next.AddWeighted("e", 2)
+	plan, err := hash.Diff(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//区间内的key恰好就是换了节点的key
+	moved, n := 0, 100000
+	for i := 0; i < n; i++ {
+		key := "key" + strconv.Itoa(i)
+		from, to := hash.Get(key), next.Get(key)
+		pos := uint64(crc32.ChecksumIEEE([]byte(key)))
+		inRange := ""
+		for _, mv := range plan.Moves {
+			for _, r := range mv.Ranges {
+				if (r.Start < r.End && pos > r.Start && pos <= r.End) ||
+					(r.Start >= r.End && (pos > r.Start || pos <= r.End)) {
+					inRange = mv.From + "->" + mv.To
+				}
+			}
+		}
+		if from != to {
+			moved++
+			if inRange != from+"->"+to {
+				t.Fatalf("key %s moved %s->%s but plan says %q", key, from, to, inRange)
+			}
+		} else if inRange != "" {
+			t.Fatalf("key %s did not move but plan says %q", key, inRange)
+		}
+	}
+	//按区间估算的比例与实际移动的比例接近
+	if got := float64(moved) / float64(n); math.Abs(got-plan.Fraction) > 0.02 {
+		t.Errorf("estimated %.3f of keys to move, %.3f actually moved", plan.Fraction, got)
+	}
+	if _, err := hash.Diff(New64(50, nil)); err == nil {
+		t.Error("expected error when diffing rings of different widths")
+	}
+}
+
+func TestHashTag(t *testing.T) {
+	tests := []struct {
+		tag  HashTag
+		key  string
+		want string
+	}{
+		{DefaultHashTag, "user:{42}:profile", "42"},
+		{DefaultHashTag, "user:{}:profile", "user:{}:profile"},
+		{DefaultHashTag, "user:{42", "user:{42"},
+		{DefaultHashTag, "{a}{b}", "a"},
+		{HashTag{Open: "<<", Close: ">>"}, "order:<<7>>:items", "7"},
+		{HashTag{}, "user:{42}:profile", "user:{42}:profile"},
+	}
+	for _, tt := range tests {
+		if got := tt.tag.Extract(tt.key); got != tt.want {
+			t.Errorf("%+v.Extract(%q) = %q, want %q", tt.tag, tt.key, got, tt.want)
+		}
+	}
+
+	m := New(50, nil)
+	m.SetHashTag(DefaultHashTag)
+	m.Add("a", "b", "c", "d")
+	for i := 0; i < 100; i++ {
+		profile, scores := "user:{"+strconv.Itoa(i)+"}:profile", "user:{"+strconv.Itoa(i)+"}:scores"
+		if m.Get(profile) != m.Get(scores) {
+			t.Fatalf("%s and %s landed on different nodes", profile, scores)
+		}
+		if got := m.GetN(profile, 2); !reflect.DeepEqual(got, m.GetN(scores, 2)) {
+			t.Fatalf("GetN differs for %s and %s", profile, scores)
+		}
+	}
+}
+
+func TestSpread(t *testing.T) {
+	labels := map[string]Labels{
+		"a1": {Zone: "az1", Rack: "r1"},
+		"a2": {Zone: "az1", Rack: "r1"},
+		"a3": {Zone: "az1", Rack: "r2"},
+		"b1": {Zone: "az2", Rack: "r1"},
+		"c1": {Zone: "az3", Rack: "r1"},
+	}
+	lookup := func(node string) Labels { return labels[node] }
+	tests := []struct {
+		preference []string
+		n          int
+		want       []string
+	}{
+		//先覆盖所有可用区，再覆盖同一可用区内的其他机架
+		{[]string{"a1", "a2", "a3", "b1", "c1"}, 3, []string{"a1", "b1", "c1"}},
+		{[]string{"a1", "a2", "a3", "b1", "c1"}, 4, []string{"a1", "b1", "c1", "a3"}},
+		{[]string{"a1", "a2", "a3", "b1", "c1"}, 5, []string{"a1", "b1", "c1", "a3", "a2"}},
+		{[]string{"a2", "a1"}, 3, []string{"a2", "a1"}},
+		{nil, 3, nil},
+	}
+	for _, tt := range tests {
+		if got := Spread(tt.preference, tt.n, lookup); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Spread(%v, %d) = %v, want %v", tt.preference, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestRemovePublishesCopy(t *testing.T) {
+	m := New(3, nil)
+	m.Add("a", "b")
+	before := m.loadValues()
+	m.Remove("a")
+	//已经取出的快照不受影响，新的环中不再有a
+	if _, ok := before.nodes["a"]; !ok || len(before.keys) != 6 {
+		t.Fatalf("Remove modified a published snapshot: %d keys, nodes %v", len(before.keys), before.nodes)
+	}
+	if after := m.loadValues(); len(after.keys) != 3 || after.nodes["a"] != 0 {
+		t.Fatalf("ring after Remove has %d keys, nodes %v", len(after.keys), after.nodes)
+	}
+}
@@ -0,0 +1,139 @@
+// Package consistenthash
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+package consistenthash
+
+import (
+	"fmt"
+	"hash/crc32"
+	"math"
+	"testing"
+)
+
+func TestHashVectors(t *testing.T) {
+	long := "Nobody inspects the spammish repetition"
+	tests32 := []struct {
+		name string
+		fn   Hash
+		in   string
+		want uint32
+	}{
+		{"fnv1a", FNV1a, "", 0x811c9dc5},
+		{"fnv1a", FNV1a, "a", 0xe40c292c},
+		{"murmur3", Murmur3, "", 0},
+		{"murmur3", Murmur3, "hello", 0x248bfa47},
+		{"murmur3", Murmur3, "The quick brown fox jumps over the lazy dog", 0x2e4ff723},
+	}
+	for _, tt := range tests32 {
+		if got := tt.fn([]byte(tt.in)); got != tt.want {
+			t.Errorf("%s(%q) = %#x, want %#x", tt.name, tt.in, got, tt.want)
+		}
+	}
+	tests64 := []struct {
+		name string
+		fn   Hash64
+		in   string
+		want uint64
+	}{
+		{"fnv1a64", FNV1a64, "a", 0xaf63dc4c8601ec8c},
+		{"xxhash64", XXHash64, "", 0xef46db3751d8e999},
+		{"xxhash64", XXHash64, "abc", 0x44bc2cf5ad770999},
+		{"xxhash64", XXHash64, long, 0xfbcea83c8a378bf1},
+	}
+	for _, tt := range tests64 {
+		if got := tt.fn([]byte(tt.in)); got != tt.want {
+			t.Errorf("%s(%q) = %#x, want %#x", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+//统计环上每个节点分到的key数，返回标准差和平均值
+func ringStdDev(m *Map, nodes, keys []string) (stddev, mean float64) {
+	counts := make(map[string]int, len(nodes))
+	for _, key := range keys {
+		counts[m.Get(key)]++
+	}
+	mean = float64(len(keys)) / float64(len(nodes))
+	var sum float64
+	for _, node := range nodes {
+		d := float64(counts[node]) - mean
+		sum += d * d
+	}
+	return math.Sqrt(sum / float64(len(nodes))), mean
+}
+
+// TestHashDistribution 报告不同哈希函数在短key上的分布，使用 go test -v -run HashDistribution 查看
+func TestHashDistribution(t *testing.T) {
+	nodes := make([]string, 10)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("10.0.0.%d:8001", i+1)
+	}
+	//短key是crc32分布不均的主要场景
+	keys := make([]string, 100000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("u%d", i)
+	}
+	rings := []struct {
+		name string
+		m    *Map
+	}{
+		{"crc32", New(50, crc32.ChecksumIEEE)},
+		{"fnv1a", New(50, FNV1a)},
+		{"murmur3", New(50, Murmur3)},
+		{"xxhash", New(50, XXHash)},
+		{"fnv1a64", New64(50, FNV1a64)},
+		{"xxhash64", New64(50, XXHash64)},
+	}
+	for _, r := range rings {
+		r.m.Add(nodes...)
+		stddev, mean := ringStdDev(r.m, nodes, keys)
+		t.Logf("%-9s stddev %8.1f keys (%.1f%% of mean %.0f)", r.name, stddev, 100*stddev/mean, mean)
+		if r.name != "crc32" && stddev/mean > 0.25 {
+			t.Errorf("%s: distribution too uneven, stddev %.1f%% of mean", r.name, 100*stddev/mean)
+		}
+	}
+}
+
+func TestHashing64(t *testing.T) {
+	m := New64(50, nil)
+	m.Add("a", "b", "c")
+	//64位环与32位环的接口一致
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		nodes := m.GetN(key, 3)
+		if len(nodes) != 3 || nodes[0] != m.Get(key) {
+			t.Fatalf("GetN(%s) = %v, Get = %s", key, nodes, m.Get(key))
+		}
+	}
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		before[key] = m.Get(key)
+	}
+	m.Remove("b")
+	for key, node := range before {
+		if node != "b" && m.Get(key) != node {
+			t.Fatalf("key %s moved from %s although b was removed", key, node)
+		}
+	}
+}
+
+func BenchmarkHash(b *testing.B) {
+	data := []byte("user:10086:profile")
+	fns := []struct {
+		name string
+		fn   Hash
+	}{
+		{"crc32", crc32.ChecksumIEEE},
+		{"fnv1a", FNV1a},
+		{"murmur3", Murmur3},
+		{"xxhash", XXHash},
+	}
+	for _, f := range fns {
+		b.Run(f.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				f.fn(data)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+// Package consistenthash
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// hash tag：key中被标记的部分决定key落在哪个节点上，相关的key可以放在同一个节点
+package consistenthash
+
+import "strings"
+
+// HashTag key中标记的起止分隔符，例如 user:{42}:profile 和 user:{42}:scores 都只按42计算
+// 零值表示不使用hash tag，始终按整个key计算
+type HashTag struct {
+	Open  string
+	Close string
+}
+
+// DefaultHashTag 与Redis Cluster相同的{}
+var DefaultHashTag = HashTag{Open: "{", Close: "}"}
+
+// Extract 返回key中参与哈希的部分
+// 只使用第一个Open与其后第一个Close之间的内容，没有完整的标记或标记为空时返回整个key
+func (t HashTag) Extract(key string) string {
+	if t.Open == "" || t.Close == "" {
+		return key
+	}
+	start := strings.Index(key, t.Open)
+	if start < 0 {
+		return key
+	}
+	rest := key[start+len(t.Open):]
+	end := strings.Index(rest, t.Close)
+	if end <= 0 {
+		return key
+	}
+	return rest[:end]
+}
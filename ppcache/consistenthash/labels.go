@@ -0,0 +1,51 @@
+// Package consistenthash
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// 节点的故障域，选择多个副本时尽量分散到不同的可用区和机架
+package consistenthash
+
+// Labels 节点所在的故障域，空字符串表示未知
+type Labels struct {
+	Zone string `json:"zone,omitempty"` //可用区
+	Rack string `json:"rack,omitempty"` //机架
+}
+
+// Spread 从按优先级排列的节点中选出n个，结果中的第一个始终是preference[0]
+// 优先选择可用区还没有出现过的节点，其次是机架没有出现过的节点，最后按原来的顺序补足
+// preference一般是 Picker.GetN(key, 节点总数) 的结果，只要输入相同，所有节点得到的结果就相同
+func Spread(preference []string, n int, labels func(node string) Labels) []string {
+	if n > len(preference) {
+		n = len(preference)
+	}
+	if n <= 0 {
+		return nil
+	}
+	picked := make([]string, 0, n)
+	used := make(map[string]bool, n)
+	zones := make(map[string]bool, n)
+	racks := make(map[Labels]bool, n)
+	take := func(node string) {
+		l := labels(node)
+		picked = append(picked, node)
+		used[node] = true
+		zones[l.Zone] = true
+		racks[l] = true
+	}
+	//第一轮只选新的可用区，第二轮只选新的机架，第三轮不限制
+	passes := []func(l Labels) bool{
+		func(l Labels) bool { return !zones[l.Zone] },
+		func(l Labels) bool { return !racks[l] },
+		func(l Labels) bool { return true },
+	}
+	for _, accept := range passes {
+		for _, node := range preference {
+			if len(picked) == n {
+				return picked
+			}
+			if !used[node] && accept(labels(node)) {
+				take(node)
+			}
+		}
+	}
+	return picked
+}
@@ -0,0 +1,427 @@
+// Package consistenthash
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// 节点选择算法的统一接口，以及一致性哈希环以外的几种实现
+package consistenthash
+
+import (
+	"fmt"
+	"hash/crc32"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Picker 根据key选择真实节点的算法，HTTPPool通过它挑选节点
+type Picker interface {
+	// Add 添加权重为1的节点
+	Add(nodes ...string)
+	// AddWeighted 添加带权重的节点，节点已存在时更新权重
+	AddWeighted(node string, weight int)
+	// Remove 删除节点
+	Remove(node string)
+	// Get 返回key所属的节点，没有节点时返回空字符串
+	Get(key string) string
+	// GetN 按优先级返回key的前n个不同节点，第一个与Get相同，节点不足n个时返回全部节点
+	GetN(key string, n int) []string
+}
+
+// Ordered 映射取决于节点添加顺序的选择算法，Order返回决定映射的顺序
+// 成员相同但添加顺序不同的节点会把key分给不同的节点，HTTPPool把Order计入哈希环指纹以发现这种不一致
+type Ordered interface {
+	Order() []string
+}
+
+var _ Ordered = (*Jump)(nil)
+
+var _ Picker = (*Map)(nil)
+var _ Picker = (*Rendezvous)(nil)
+var _ Picker = (*Jump)(nil)
+var _ Picker = (*Maglev)(nil)
+var _ Picker = (*Slots)(nil)
+
+//splitmix64的最后一步，把哈希值打散到64位
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Rendezvous 最高随机权重(HRW)哈希，key分配给得分最高的节点
+// 增删节点时只有属于该节点的key会移动，查找的代价与节点数成正比
+type Rendezvous struct {
+	mu    sync.RWMutex
+	hash  Hash
+	nodes []rendezvousNode
+}
+
+type rendezvousNode struct {
+	name   string
+	hash   uint64  //节点名的哈希，与key的哈希组合得到得分
+	weight float64 //权重
+}
+
+// NewRendezvous 创建HRW选择器，fn为nil时使用crc32.ChecksumIEEE
+func NewRendezvous(fn Hash) *Rendezvous {
+	if fn == nil {
+		fn = crc32.ChecksumIEEE
+	}
+	return &Rendezvous{hash: fn}
+}
+
+// Add 添加权重为1的节点
+func (r *Rendezvous) Add(nodes ...string) {
+	for _, node := range nodes {
+		r.AddWeighted(node, 1)
+	}
+}
+
+// AddWeighted 添加带权重的节点，weight小于1时按1处理
+func (r *Rendezvous) AddWeighted(node string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := rendezvousNode{name: node, hash: mix64(uint64(r.hash([]byte(node)))), weight: float64(weight)}
+	for i := range r.nodes {
+		if r.nodes[i].name == node {
+			r.nodes[i] = n
+			return
+		}
+	}
+	r.nodes = append(r.nodes, n)
+}
+
+// Remove 删除节点
+func (r *Rendezvous) Remove(node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.nodes {
+		if r.nodes[i].name == node {
+			r.nodes = append(r.nodes[:i], r.nodes[i+1:]...)
+			return
+		}
+	}
+}
+
+//带权重的得分 -w/ln(u)，u是(0,1)之间的均匀分布
+func (n rendezvousNode) score(keyHash uint64) float64 {
+	h := mix64(keyHash ^ n.hash)
+	u := (float64(h>>11) + 0.5) / (1 << 53)
+	return -n.weight / math.Log(u)
+}
+
+// Get 返回得分最高的节点
+func (r *Rendezvous) Get(key string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	keyHash := mix64(uint64(r.hash([]byte(key))))
+	best, bestScore := "", -1.0
+	for _, n := range r.nodes {
+		if s := n.score(keyHash); s > bestScore {
+			best, bestScore = n.name, s
+		}
+	}
+	return best
+}
+
+// GetN 按得分从高到低返回前n个节点
+func (r *Rendezvous) GetN(key string, n int) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if n > len(r.nodes) {
+		n = len(r.nodes)
+	}
+	if n <= 0 {
+		return nil
+	}
+	keyHash := mix64(uint64(r.hash([]byte(key))))
+	type scored struct {
+		name  string
+		score float64
+	}
+	all := make([]scored, len(r.nodes))
+	for i, node := range r.nodes {
+		all[i] = scored{node.name, node.score(keyHash)}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].score > all[j].score })
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = all[i].name
+	}
+	return nodes
+}
+
+// Jump Google的跳跃一致性哈希，几乎不占内存，查找代价为O(log n)
+// 桶按添加顺序编号，添加节点只移动1/n的key；删除节点时由最后的桶填补空出的编号，最多移动2/n的key
+// 映射取决于添加顺序，各节点需要按相同的顺序添加，例如用相同的列表调用SetPeers；通过gossip等方式增量发现成员时
+// 各节点的顺序不同，应使用哈希环或Rendezvous
+// 权重通过让节点占用多个桶实现
+type Jump struct {
+	mu      sync.RWMutex
+	hash    Hash
+	buckets []string //桶编号到节点的映射
+}
+
+// NewJump 创建跳跃一致性哈希选择器，fn为nil时使用crc32.ChecksumIEEE
+func NewJump(fn Hash) *Jump {
+	if fn == nil {
+		fn = crc32.ChecksumIEEE
+	}
+	return &Jump{hash: fn}
+}
+
+// Add 添加权重为1的节点
+func (j *Jump) Add(nodes ...string) {
+	for _, node := range nodes {
+		j.AddWeighted(node, 1)
+	}
+}
+
+// AddWeighted 添加占用weight个桶的节点，节点已存在时先删除
+func (j *Jump) AddWeighted(node string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.remove(node)
+	for i := 0; i < weight; i++ {
+		j.buckets = append(j.buckets, node)
+	}
+}
+
+// Remove 删除节点，节点占用的桶由最后的桶填补
+func (j *Jump) Remove(node string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.remove(node)
+}
+
+//从后往前删除，被换到前面的桶已经检查过
+func (j *Jump) remove(node string) {
+	for i := len(j.buckets) - 1; i >= 0; i-- {
+		if j.buckets[i] == node {
+			last := len(j.buckets) - 1
+			j.buckets[i] = j.buckets[last]
+			j.buckets = j.buckets[:last]
+		}
+	}
+}
+
+// Order 返回桶编号到节点的映射
+func (j *Jump) Order() []string {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return append([]string(nil), j.buckets...)
+}
+
+//Lamping和Veach论文中的算法，返回[0, buckets)之间的桶编号
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// Get 返回key所在桶对应的节点
+func (j *Jump) Get(key string) string {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if len(j.buckets) == 0 {
+		return ""
+	}
+	return j.buckets[jumpHash(mix64(uint64(j.hash([]byte(key)))), len(j.buckets))]
+}
+
+// GetN 第一个节点与Get相同，之后对key重新哈希得到其他节点，多次重试后仍不足时按桶的顺序补齐
+func (j *Jump) GetN(key string, n int) []string {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	distinct := make(map[string]bool)
+	for _, node := range j.buckets {
+		distinct[node] = true
+	}
+	if n > len(distinct) {
+		n = len(distinct)
+	}
+	if n <= 0 {
+		return nil
+	}
+	nodes := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	h := mix64(uint64(j.hash([]byte(key))))
+	for i := 0; i < 4*len(j.buckets) && len(nodes) < n; i++ {
+		node := j.buckets[jumpHash(h, len(j.buckets))]
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+		h = mix64(h + uint64(i) + 1)
+	}
+	for _, node := range j.buckets {
+		if len(nodes) == n {
+			break
+		}
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// DefaultMaglevSize Maglev查找表的默认大小，需要是远大于节点数的质数
+const DefaultMaglevSize = 65537
+
+// Maglev Google Maglev负载均衡器使用的哈希，查找只需一次取模
+// 每次增删节点都会重建查找表，适合查找频繁而成员变化不多的场景
+type Maglev struct {
+	mu     sync.RWMutex
+	hash   Hash
+	size   uint64         //查找表大小，质数
+	nodes  map[string]int //节点和权重
+	lookup []string       //查找表
+}
+
+// NewMaglev 创建Maglev选择器，size为查找表大小，必须是不小于2的质数，0时使用DefaultMaglevSize
+// size不是质数时排列无法填满查找表，会panic
+func NewMaglev(size int, fn Hash) *Maglev {
+	if size == 0 {
+		size = DefaultMaglevSize
+	}
+	if !isPrime(size) {
+		panic(fmt.Sprintf("consistenthash: Maglev table size %d is not a prime >= 2", size))
+	}
+	if fn == nil {
+		fn = crc32.ChecksumIEEE
+	}
+	return &Maglev{hash: fn, size: uint64(size), nodes: make(map[string]int)}
+}
+
+//试除法判断质数，查找表大小只在创建时检查一次
+func isPrime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for i := 2; i*i <= n; i++ {
+		if n%i == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Add 添加权重为1的节点
+func (m *Maglev) Add(nodes ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, node := range nodes {
+		m.nodes[node] = 1
+	}
+	m.populate()
+}
+
+// AddWeighted 添加带权重的节点，权重越大在查找表中占的位置越多
+func (m *Maglev) AddWeighted(node string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nodes[node] = weight
+	m.populate()
+}
+
+// Remove 删除节点
+func (m *Maglev) Remove(node string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.nodes, node)
+	m.populate()
+}
+
+//按论文中的方法填充查找表：每个节点按自己的排列轮流占位，权重为w的节点每轮占w个位置
+func (m *Maglev) populate() {
+	if len(m.nodes) == 0 {
+		m.lookup = nil
+		return
+	}
+	names := make([]string, 0, len(m.nodes))
+	for name := range m.nodes {
+		names = append(names, name)
+	}
+	//排序保证结果与添加顺序无关
+	sort.Strings(names)
+	offsets := make([]uint64, len(names))
+	skips := make([]uint64, len(names))
+	next := make([]uint64, len(names))
+	for i, name := range names {
+		h := mix64(uint64(m.hash([]byte(name))))
+		offsets[i] = h % m.size
+		skips[i] = (h>>32)%(m.size-1) + 1
+	}
+
+	lookup := make([]string, m.size)
+	filled := make([]bool, m.size)
+	var n uint64
+	for {
+		for i, name := range names {
+			for turn := 0; turn < m.nodes[name]; turn++ {
+				c := (offsets[i] + next[i]*skips[i]) % m.size
+				for filled[c] {
+					next[i]++
+					c = (offsets[i] + next[i]*skips[i]) % m.size
+				}
+				lookup[c] = name
+				filled[c] = true
+				next[i]++
+				n++
+				if n == m.size {
+					m.lookup = lookup
+					return
+				}
+			}
+		}
+	}
+}
+
+// Get 返回查找表中key对应的节点
+func (m *Maglev) Get(key string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.lookup) == 0 {
+		return ""
+	}
+	return m.lookup[mix64(uint64(m.hash([]byte(key))))%m.size]
+}
+
+// GetN 从key在查找表中的位置开始向后查找，返回前n个不同的节点
+func (m *Maglev) GetN(key string, n int) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if n > len(m.nodes) {
+		n = len(m.nodes)
+	}
+	if n <= 0 || len(m.lookup) == 0 {
+		return nil
+	}
+	nodes := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	start := mix64(uint64(m.hash([]byte(key)))) % m.size
+	for i := uint64(0); i < m.size && len(nodes) < n; i++ {
+		node := m.lookup[(start+i)%m.size]
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
@@ -0,0 +1,254 @@
+// Package consistenthash
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+package consistenthash
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+//各个算法的构造函数，Map使用与HTTPPool相同的默认虚拟节点倍数
+var pickers = []struct {
+	name string
+	new  func() Picker
+}{
+	{"ring", func() Picker { return New(50, nil) }},
+	{"rendezvous", func() Picker { return NewRendezvous(nil) }},
+	{"jump", func() Picker { return NewJump(nil) }},
+	{"maglev", func() Picker { return NewMaglev(5003, nil) }},
+}
+
+func testNodes(n int) []string {
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("http://10.0.0.%d:8001", i+1)
+	}
+	return nodes
+}
+
+func testKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+	return keys
+}
+
+//统计每个节点分到的key数，返回相对标准差(标准差/平均值)
+func relativeStdDev(p Picker, nodes, keys []string) float64 {
+	counts := make(map[string]int, len(nodes))
+	for _, key := range keys {
+		counts[p.Get(key)]++
+	}
+	mean := float64(len(keys)) / float64(len(nodes))
+	var sum float64
+	for _, node := range nodes {
+		d := float64(counts[node]) - mean
+		sum += d * d
+	}
+	return math.Sqrt(sum/float64(len(nodes))) / mean
+}
+
+//统计两次查找结果不同的key所占的比例
+func movedFraction(before map[string]string, p Picker) float64 {
+	moved := 0
+	for key, node := range before {
+		if p.Get(key) != node {
+			moved++
+		}
+	}
+	return float64(moved) / float64(len(before))
+}
+
+func snapshot(p Picker, keys []string) map[string]string {
+	m := make(map[string]string, len(keys))
+	for _, key := range keys {
+		m[key] = p.Get(key)
+	}
+	return m
+}
+
+func TestPickerDistribution(t *testing.T) {
+	nodes, keys := testNodes(8), testKeys(50000)
+	for _, tt := range pickers {
+		p := tt.new()
+		p.Add(nodes...)
+		dev := relativeStdDev(p, nodes, keys)
+		t.Logf("%-10s relative stddev across %d nodes: %.3f", tt.name, len(nodes), dev)
+		if dev > 0.3 {
+			t.Errorf("%s: distribution too uneven, relative stddev %.3f", tt.name, dev)
+		}
+	}
+}
+
+func TestPickerKeyMovement(t *testing.T) {
+	nodes, keys := testNodes(8), testKeys(50000)
+	for _, tt := range pickers {
+		p := tt.new()
+		p.Add(nodes...)
+		before := snapshot(p, keys)
+
+		//添加第9个节点，理想情况下移动1/9的key
+		extra := "http://10.0.0.100:8001"
+		p.Add(extra)
+		added := movedFraction(before, p)
+		//只应该有key移动到新节点，Maglev为了均匀会有少量key在原有节点之间移动
+		shuffled := 0
+		for key, node := range before {
+			if now := p.Get(key); now != node && now != extra {
+				shuffled++
+			}
+		}
+		limit := 0
+		if tt.name == "maglev" {
+			limit = len(keys) / 50
+		}
+		if shuffled > limit {
+			t.Errorf("%s: %d keys moved between existing nodes", tt.name, shuffled)
+		}
+
+		//删除一个原有节点
+		p.Remove(extra)
+		p.Remove(nodes[3])
+		removed := movedFraction(before, p)
+		t.Logf("%-10s moved on add: %.3f (%d between old nodes), on remove: %.3f", tt.name, added, shuffled, removed)
+		if added > 2.0/9 {
+			t.Errorf("%s: adding a node moved %.3f of keys", tt.name, added)
+		}
+		if removed > 2.0/8 {
+			t.Errorf("%s: removing a node moved %.3f of keys", tt.name, removed)
+		}
+	}
+}
+
+func TestJumpOrder(t *testing.T) {
+	nodes, keys := testNodes(8), testKeys(10000)
+	a, b := NewJump(nil), NewJump(nil)
+	a.Add(nodes...)
+	b.Add(nodes...)
+	//添加后又删除的节点不影响其他节点的桶
+	b.Add("http://10.0.0.100:8001")
+	b.Remove("http://10.0.0.100:8001")
+	for _, key := range keys {
+		if a.Get(key) != b.Get(key) {
+			t.Fatalf("%s: %s vs %s", key, a.Get(key), b.Get(key))
+		}
+	}
+	if !reflect.DeepEqual(a.Order(), nodes) {
+		t.Fatalf("order = %v, want %v", a.Order(), nodes)
+	}
+	//添加顺序不同时映射不同，Order也不同
+	c := NewJump(nil)
+	for i := len(nodes) - 1; i >= 0; i-- {
+		c.Add(nodes[i])
+	}
+	if reflect.DeepEqual(a.Order(), c.Order()) {
+		t.Fatal("different insertion orders should report different orders")
+	}
+	//删除中间的节点时最后的桶补上空位
+	a.Remove(nodes[3])
+	want := append(append([]string(nil), nodes[:3]...), nodes[7], nodes[4], nodes[5], nodes[6])
+	if !reflect.DeepEqual(a.Order(), want) {
+		t.Fatalf("order after remove = %v, want %v", a.Order(), want)
+	}
+}
+
+func TestMaglevSize(t *testing.T) {
+	for _, size := range []int{-1, 1, 100, 65536} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), strconv.Itoa(size)) {
+					t.Errorf("NewMaglev(%d) should panic naming the size, got %v", size, r)
+				}
+			}()
+			NewMaglev(size, nil)
+		}()
+	}
+	m := NewMaglev(2, nil)
+	m.Add("a", "b")
+	if m.Get("key") == "" {
+		t.Fatal("size 2 should work")
+	}
+}
+
+func TestPickerWeighted(t *testing.T) {
+	keys := testKeys(20000)
+	for _, tt := range pickers {
+		p := tt.new()
+		p.AddWeighted("small", 1)
+		p.AddWeighted("large", 3)
+		counts := make(map[string]int)
+		for _, key := range keys {
+			counts[p.Get(key)]++
+		}
+		if counts["large"] < 2*counts["small"] {
+			t.Errorf("%s: weight 3 node got %d keys, weight 1 node got %d", tt.name, counts["large"], counts["small"])
+		}
+	}
+}
+
+func TestPickerEmpty(t *testing.T) {
+	for _, tt := range pickers {
+		p := tt.new()
+		if got := p.Get("key"); got != "" {
+			t.Errorf("%s: empty picker returned %q", tt.name, got)
+		}
+		p.Add("a")
+		p.Remove("a")
+		if got := p.Get("key"); got != "" {
+			t.Errorf("%s: picker returned removed node %q", tt.name, got)
+		}
+	}
+}
+
+func BenchmarkPickerGet(b *testing.B) {
+	keys := testKeys(1024)
+	for _, n := range []int{8, 64, 512} {
+		for _, tt := range pickers {
+			p := tt.new()
+			p.Add(testNodes(n)...)
+			b.Run(fmt.Sprintf("%s/%d", tt.name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					p.Get(keys[i&1023])
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkPickerAdd(b *testing.B) {
+	nodes := testNodes(64)
+	for _, tt := range pickers {
+		b.Run(tt.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				p := tt.new()
+				p.Add(nodes...)
+			}
+		})
+	}
+}
+
+func TestPickerGetN(t *testing.T) {
+	nodes, keys := testNodes(5), testKeys(1000)
+	for _, tt := range pickers {
+		p := tt.new()
+		p.Add(nodes...)
+		for _, key := range keys {
+			got := p.GetN(key, 3)
+			if len(got) != 3 || got[0] != p.Get(key) {
+				t.Fatalf("%s: GetN(%s, 3) = %v, Get = %s", tt.name, key, got, p.Get(key))
+			}
+			if got[0] == got[1] || got[1] == got[2] || got[0] == got[2] {
+				t.Fatalf("%s: GetN(%s, 3) returned duplicates %v", tt.name, key, got)
+			}
+		}
+		if got := p.GetN("key", 10); len(got) != len(nodes) {
+			t.Errorf("%s: GetN with n larger than nodes returned %d nodes", tt.name, len(got))
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Package consistenthash
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// 比较两个哈希环，计算成员变化时哪些区间换了节点，以及受影响的key所占的比例
+package consistenthash
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// Range 哈希环上的一段区间 (Start, End]，Start大于End时表示跨过了环的起点
+type Range struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+// Move 从From移动到To的所有区间，Fraction为这些区间占整个环的比例
+type Move struct {
+	From     string  `json:"from"`
+	To       string  `json:"to"`
+	Ranges   []Range `json:"ranges"`
+	Fraction float64 `json:"fraction"`
+}
+
+// Plan 两个环之间的差异，假设key在环上均匀分布，Fraction即为需要移动的key的比例
+type Plan struct {
+	Moves    []Move  `json:"moves"`
+	Fraction float64 `json:"fraction"`
+}
+
+// Clone 复制当前的环，修改副本不影响原来的环，用于在变更前预演
+func (m *Map) Clone() *Map {
+	c := &Map{
+		hash:     m.hash,
+		hash64:   m.hash64,
+		replicas: m.replicas,
+		tag:      m.tag,
+	}
+	c.values.Store(m.copyValues())
+	return c
+}
+
+//环的位数，32位环上的位置都在[0, 2^32)之间
+func (m *Map) bits() uint {
+	if m.hash64 != nil {
+		return 64
+	}
+	return 32
+}
+
+//返回位置p所属的真实节点，环为空时返回空字符串
+func (v *values) ownerAt(p int) string {
+	if len(v.keys) == 0 {
+		return ""
+	}
+	idx := sort.SearchInts(v.keys, p)
+	return v.hashMap[v.keys[idx%len(v.keys)]]
+}
+
+// Diff 计算从当前的环变为next时换了节点的区间，两个环需要使用相同的哈希函数
+func (m *Map) Diff(next *Map) (*Plan, error) {
+	if m.bits() != next.bits() {
+		return nil, errors.New("consistenthash: cannot diff rings of different widths")
+	}
+	bits := m.bits()
+	oldValues, newValues := m.loadValues(), next.loadValues()
+
+	//两个环上所有的位置把环切成若干段，每一段在两个环上各自只属于一个节点
+	points := make([]int, 0, len(oldValues.keys)+len(newValues.keys))
+	points = append(points, oldValues.keys...)
+	points = append(points, newValues.keys...)
+	sort.Ints(points)
+	uniq := points[:0]
+	for i, p := range points {
+		if i == 0 || p != points[i-1] {
+			uniq = append(uniq, p)
+		}
+	}
+	points = uniq
+
+	plan := &Plan{}
+	if len(points) == 0 {
+		return plan, nil
+	}
+	space := math.Exp2(float64(bits))
+	moves := make(map[[2]string]*Move)
+	var order [][2]string
+	for i, end := range points {
+		from, to := oldValues.ownerAt(end), newValues.ownerAt(end)
+		if from == to {
+			continue
+		}
+		start := points[(i+len(points)-1)%len(points)]
+		r := Range{Start: uint64(start), End: uint64(end)}
+		var length float64
+		if len(points) == 1 {
+			length = space
+		} else {
+			length = float64(segmentLength(r, bits))
+		}
+		if bits == 32 {
+			r.Start, r.End = r.Start&math.MaxUint32, r.End&math.MaxUint32
+		}
+
+		key := [2]string{from, to}
+		mv, ok := moves[key]
+		if !ok {
+			mv = &Move{From: from, To: to}
+			moves[key] = mv
+			order = append(order, key)
+		}
+		//与上一段相连时合并为一个区间
+		if n := len(mv.Ranges); n > 0 && mv.Ranges[n-1].End == r.Start {
+			mv.Ranges[n-1].End = r.End
+		} else {
+			mv.Ranges = append(mv.Ranges, r)
+		}
+		mv.Fraction += length / space
+		plan.Fraction += length / space
+	}
+
+	sort.Slice(order, func(i, j int) bool {
+		if order[i][0] != order[j][0] {
+			return order[i][0] < order[j][0]
+		}
+		return order[i][1] < order[j][1]
+	})
+	for _, key := range order {
+		plan.Moves = append(plan.Moves, *moves[key])
+	}
+	return plan, nil
+}
+
+//区间的长度，按环的位数回绕
+func segmentLength(r Range, bits uint) uint64 {
+	l := r.End - r.Start
+	if bits == 32 {
+		l &= math.MaxUint32
+	}
+	return l
+}
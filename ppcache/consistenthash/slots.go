@@ -0,0 +1,285 @@
+// Package consistenthash
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// 与Redis Cluster相同的哈希槽：key按crc16映射到固定数量的槽，槽通过显式的槽表分配给节点
+package consistenthash
+
+import (
+	"sort"
+	"sync"
+)
+
+// SlotCount 槽的数量，与Redis Cluster相同
+const SlotCount = 16384
+
+//crc16的查找表，CCITT多项式0x1021(XMODEM)
+var crc16Table = func() (t [256]uint16) {
+	for i := range t {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		t[i] = crc
+	}
+	return
+}()
+
+// CRC16 Redis Cluster使用的crc16(XMODEM)
+func CRC16(data []byte) uint16 {
+	var crc uint16
+	for _, c := range data {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^c]
+	}
+	return crc
+}
+
+// KeySlot 返回key所属的槽，包含{tag}的key只按tag计算，tag相同的key落在同一个槽
+func KeySlot(key string) int {
+	return int(CRC16([]byte(DefaultHashTag.Extract(key))) % SlotCount)
+}
+
+// SlotRange 连续分配给同一个节点的槽 [Start, End]
+type SlotRange struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Node  string `json:"node"`
+}
+
+// Slots 哈希槽选择器，每个槽属于一个节点
+// 没有调用过Assign和Migrate时，槽按节点名排序后按权重连续均分，所有节点只要成员相同就得到相同的槽表；
+// 显式分配过之后槽表由使用方维护，新增的节点不会自动分到槽，删除节点后它的槽变为未分配
+type Slots struct {
+	mu        sync.RWMutex
+	owner     [SlotCount]string //每个槽所属的节点，空字符串表示未分配
+	migrating map[int]string    //正在迁移的槽和迁移的目标节点
+	nodes     map[string]int    //节点和权重
+	pinned    bool              //槽表是否已经显式分配过
+	tag       HashTag           //key中参与哈希的部分，默认为{}
+}
+
+// NewSlots 创建哈希槽选择器
+func NewSlots() *Slots {
+	return &Slots{
+		migrating: make(map[int]string),
+		nodes:     make(map[string]int),
+		tag:       DefaultHashTag,
+	}
+}
+
+// SetHashTag 更换hash tag的分隔符，零值表示按整个key计算，需要在使用之前调用
+func (s *Slots) SetHashTag(tag HashTag) {
+	s.tag = tag
+}
+
+// Slot 返回key所属的槽
+func (s *Slots) Slot(key string) int {
+	return int(CRC16([]byte(s.tag.Extract(key))) % SlotCount)
+}
+
+// Add 添加权重为1的节点
+func (s *Slots) Add(nodes ...string) {
+	for _, node := range nodes {
+		s.AddWeighted(node, 1)
+	}
+}
+
+// AddWeighted 添加带权重的节点，权重只在自动分配槽时生效，weight小于1时按1处理
+func (s *Slots) AddWeighted(node string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodes[node] = weight
+	s.layout()
+}
+
+// Remove 删除节点，显式分配过槽表时该节点的槽和以它为目标的迁移都会被清除
+func (s *Slots) Remove(node string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.nodes, node)
+	if !s.pinned {
+		s.layout()
+		return
+	}
+	for i := range s.owner {
+		if s.owner[i] == node {
+			s.owner[i] = ""
+		}
+	}
+	for slot, to := range s.migrating {
+		if to == node {
+			delete(s.migrating, slot)
+		}
+	}
+}
+
+//按节点名排序后按权重把槽连续地分给各个节点，结果与添加的顺序无关
+func (s *Slots) layout() {
+	if s.pinned {
+		return
+	}
+	names := make([]string, 0, len(s.nodes))
+	total := 0
+	for name, weight := range s.nodes {
+		names = append(names, name)
+		total += weight
+	}
+	sort.Strings(names)
+	slot, acc := 0, 0
+	for _, name := range names {
+		acc += s.nodes[name]
+		end := SlotCount * acc / total
+		for ; slot < end; slot++ {
+			s.owner[slot] = name
+		}
+	}
+	for ; slot < SlotCount; slot++ {
+		s.owner[slot] = ""
+	}
+}
+
+// Nodes 返回所有节点，按名称排序
+func (s *Slots) Nodes() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.nodes))
+	for name := range s.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Owner 返回槽所属的节点，未分配时返回空字符串
+func (s *Slots) Owner(slot int) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.owner[slot]
+}
+
+// Assign 将槽分配给节点，之后槽表不再自动调整，节点不必已经通过Add添加
+// 收到其他节点的MOVED时应使用Moved，不会把自动分配的槽表变为显式分配
+func (s *Slots) Assign(node string, slots ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pinned = true
+	for _, slot := range slots {
+		s.owner[slot] = node
+		if s.migrating[slot] == node {
+			delete(s.migrating, slot)
+		}
+	}
+}
+
+// Moved 按其他节点返回的MOVED把槽交给node
+// 与Assign不同，自动分配的槽表仍然保持自动，之后成员变化时按节点重新计算，新的节点同样会分到槽
+func (s *Slots) Moved(node string, slot int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.owner[slot] = node
+	if s.migrating[slot] == node {
+		delete(s.migrating, slot)
+	}
+}
+
+// Migrate 开始把槽迁移到节点to，迁移完成前槽仍然属于原来的节点
+// 原节点对本地没有缓存的key返回ASK重定向，请求方带着Asking标记到to上读取
+func (s *Slots) Migrate(slot int, to string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pinned = true
+	if s.owner[slot] == to {
+		delete(s.migrating, slot)
+		return
+	}
+	s.migrating[slot] = to
+}
+
+// Migrating 返回槽正在迁移的目标节点
+func (s *Slots) Migrating(slot int) (to string, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	to, ok = s.migrating[slot]
+	return
+}
+
+// FinishMigration 完成槽的迁移，槽从此属于目标节点，没有在迁移时返回false
+func (s *Slots) FinishMigration(slot int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	to, ok := s.migrating[slot]
+	if !ok {
+		return false
+	}
+	s.owner[slot] = to
+	delete(s.migrating, slot)
+	return true
+}
+
+// CancelMigration 取消槽的迁移，槽继续属于原来的节点
+func (s *Slots) CancelMigration(slot int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.migrating, slot)
+}
+
+// Ranges 返回槽表，相邻且属于同一个节点的槽合并为一段，未分配的槽不出现在结果中
+func (s *Slots) Ranges() []SlotRange {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var ranges []SlotRange
+	for slot, node := range s.owner {
+		if node == "" {
+			continue
+		}
+		if n := len(ranges); n > 0 && ranges[n-1].Node == node && ranges[n-1].End == slot-1 {
+			ranges[n-1].End = slot
+			continue
+		}
+		ranges = append(ranges, SlotRange{Start: slot, End: slot, Node: node})
+	}
+	return ranges
+}
+
+// Migrations 返回所有正在迁移的槽和目标节点
+func (s *Slots) Migrations() map[int]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m := make(map[int]string, len(s.migrating))
+	for slot, to := range s.migrating {
+		m[slot] = to
+	}
+	return m
+}
+
+// Get 返回key所属槽的节点，槽未分配时返回空字符串
+func (s *Slots) Get(key string) string {
+	return s.Owner(s.Slot(key))
+}
+
+// GetN 第一个为槽的所属节点，之后按槽号递增的顺序依次取其他槽的不同节点
+func (s *Slots) GetN(key string, n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	start := s.Slot(key)
+	var nodes []string
+	seen := make(map[string]bool, n)
+	for i := 0; i < SlotCount && len(nodes) < n; i++ {
+		node := s.owner[(start+i)%SlotCount]
+		if node == "" || seen[node] {
+			continue
+		}
+		seen[node] = true
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
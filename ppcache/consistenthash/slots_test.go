@@ -0,0 +1,116 @@
+// Package consistenthash
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+package consistenthash
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestKeySlot(t *testing.T) {
+	if got := CRC16([]byte("123456789")); got != 0x31c3 {
+		t.Fatalf("CRC16(123456789) = %#x, want 0x31c3", got)
+	}
+	//与Redis CLUSTER KEYSLOT的结果一致
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{"foo", 12182},
+		{"bar", 5061},
+		{"{user1000}.following", KeySlot("user1000")},
+		{"{user1000}.followers", KeySlot("user1000")},
+		{"foo{}{bar}", int(CRC16([]byte("foo{}{bar}")) % SlotCount)},
+		{"foo{{bar}}zap", KeySlot("{bar")},
+		{"foo{bar}{zap}", KeySlot("bar")},
+	}
+	for _, tt := range tests {
+		if got := KeySlot(tt.key); got != tt.want {
+			t.Errorf("KeySlot(%q) = %d, want %d", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestSlotsLayout(t *testing.T) {
+	//自动分配的槽表与添加顺序无关
+	a, b := NewSlots(), NewSlots()
+	a.Add("n1", "n2", "n3")
+	b.Add("n3", "n1", "n2")
+	for slot := 0; slot < SlotCount; slot++ {
+		if a.Owner(slot) != b.Owner(slot) {
+			t.Fatalf("slot %d: %s != %s", slot, a.Owner(slot), b.Owner(slot))
+		}
+	}
+
+	w := NewSlots()
+	w.AddWeighted("big", 3)
+	w.AddWeighted("small", 1)
+	counts := make(map[string]int)
+	for _, r := range w.Ranges() {
+		counts[r.Node] += r.End - r.Start + 1
+	}
+	if counts["big"] != 3*SlotCount/4 || counts["small"] != SlotCount/4 {
+		t.Fatalf("weighted layout %v", counts)
+	}
+
+	w.Remove("big")
+	if r := w.Ranges(); len(r) != 1 || r[0].Node != "small" || r[0].End-r[0].Start+1 != SlotCount {
+		t.Fatalf("remaining node should own every slot, got %v", r)
+	}
+}
+
+func TestSlotsMigration(t *testing.T) {
+	s := NewSlots()
+	s.Add("a", "b")
+	slot := s.Slot("{tag}key")
+	from := s.Owner(slot)
+	to := "a"
+	if from == "a" {
+		to = "b"
+	}
+
+	s.Migrate(slot, to)
+	if got, ok := s.Migrating(slot); !ok || got != to {
+		t.Fatalf("Migrating(%d) = %s, %v", slot, got, ok)
+	}
+	if s.Get("{tag}other") != from {
+		t.Fatal("slot should stay with the source until the migration finishes")
+	}
+	if !s.FinishMigration(slot) || s.Get("{tag}key") != to {
+		t.Fatalf("slot %d should belong to %s after the migration", slot, to)
+	}
+	if s.FinishMigration(slot) {
+		t.Fatal("finishing twice should report no migration")
+	}
+
+	//显式分配后新增节点不会自动分到槽
+	s.Add("c")
+	for _, r := range s.Ranges() {
+		if r.Node == "c" {
+			t.Fatalf("pinned table gave slots to a new node: %v", r)
+		}
+	}
+	s.Assign("c", 0, 1, 2)
+	if s.Owner(1) != "c" {
+		t.Fatalf("Owner(1) = %s, want c", s.Owner(1))
+	}
+	//删除节点后它的槽变为未分配
+	s.Remove("c")
+	if s.Owner(1) != "" {
+		t.Fatalf("Owner(1) = %s after removing c", s.Owner(1))
+	}
+	if got := s.GetN("k", 5); len(got) != 2 {
+		t.Fatalf("GetN returned %v, want both remaining nodes", got)
+	}
+}
+
+func BenchmarkSlotsGet(b *testing.B) {
+	s := NewSlots()
+	for i := 0; i < 10; i++ {
+		s.Add(fmt.Sprintf("node%d", i))
+	}
+	for i := 0; i < b.N; i++ {
+		s.Get("user:10086:profile")
+	}
+}
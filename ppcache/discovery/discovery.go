@@ -0,0 +1,82 @@
+// Package discovery
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// 节点发现：从外部来源获取节点列表，变化时按差异更新HTTPPool
+package discovery
+
+import (
+	"context"
+	"ppcache"
+)
+
+// Discovery 节点发现的来源
+type Discovery interface {
+	// Watch 开始发现节点，先发送一次当前的完整节点列表，之后每次变化时再发送完整的列表
+	// 首次获取失败时返回错误；ctx取消后关闭channel
+	Watch(ctx context.Context) (<-chan []ppcache.Peer, error)
+}
+
+// Sync 把发现的节点持续应用到pool上，直到ctx取消或来源关闭channel
+func Sync(ctx context.Context, d Discovery, pool *ppcache.HTTPPool) error {
+	ch, err := d.Watch(ctx)
+	if err != nil {
+		return err
+	}
+	for peers := range ch {
+		Apply(pool, peers)
+	}
+	return ctx.Err()
+}
+
+// Apply 按差异更新pool：删除不在列表中的节点，添加新节点以及权重、故障域有变化的节点，其余节点保持不变
+func Apply(pool *ppcache.HTTPPool, peers []ppcache.Peer) (added, removed int) {
+	want := make(map[string]ppcache.Peer, len(peers))
+	for _, peer := range peers {
+		if peer.Weight < 1 {
+			peer.Weight = 1
+		}
+		want[peer.Addr] = peer
+	}
+	have := make(map[string]ppcache.Peer)
+	var remove []string
+	for _, peer := range pool.Membership().Peers {
+		have[peer.Addr] = peer
+		if _, ok := want[peer.Addr]; !ok {
+			remove = append(remove, peer.Addr)
+		}
+	}
+	var add []ppcache.Peer
+	for _, peer := range peers {
+		if peer.Weight < 1 {
+			peer.Weight = 1
+		}
+		if old, ok := have[peer.Addr]; !ok || old != peer {
+			add = append(add, peer)
+		}
+	}
+	if len(remove) > 0 {
+		pool.RemovePeers(remove...)
+	}
+	if len(add) > 0 {
+		pool.AddPeers(add...)
+	}
+	return len(add), len(remove)
+}
+
+//两个节点列表是否相同，不考虑顺序
+func samePeers(a, b []ppcache.Peer) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[ppcache.Peer]int, len(a))
+	for _, peer := range a {
+		set[peer]++
+	}
+	for _, peer := range b {
+		if set[peer] == 0 {
+			return false
+		}
+		set[peer]--
+	}
+	return true
+}
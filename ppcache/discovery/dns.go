@@ -0,0 +1,171 @@
+// Package discovery
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// 定期解析DNS的SRV或A/AAAA记录得到节点列表，适合headless service
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"ppcache"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDNSInterval = 30 * time.Second //默认的解析间隔
+	defaultDNSJitter   = 0.1              //默认的间隔抖动比例
+	defaultDNSTimeout  = 5 * time.Second  //默认单次解析的超时时间
+)
+
+// Resolver DNS解析器，*net.Resolver实现了这个接口，测试中可以替换为进程内的实现
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// DNS 定期解析Name得到节点列表，解析失败或没有结果时保留上一次的列表
+// 所有节点的权重都为1，SRV记录中的权重会随成员数变化，不适合用作哈希环的权重
+type DNS struct {
+	Name     string        //要解析的域名，例如 _http._tcp.ppcache.default.svc.cluster.local
+	SRV      bool          //为true时查询SRV记录，端口取自记录；否则查询A/AAAA记录
+	Port     int           //查询A/AAAA记录时节点的端口
+	Scheme   string        //节点地址的协议，默认为http
+	Interval time.Duration //解析间隔，默认30秒
+	Jitter   float64       //每次间隔随机增减的比例，避免所有节点同时解析，默认0.1，小于0表示不抖动
+	Timeout  time.Duration //单次解析的超时时间，默认5秒
+	Resolver Resolver      //默认为net.DefaultResolver
+	//日志输出，默认为log.Printf
+	Logf func(format string, v ...interface{})
+}
+
+// NewSRV 创建解析SRV记录的DNS发现
+func NewSRV(name string) *DNS {
+	return &DNS{Name: name, SRV: true}
+}
+
+// NewHost 创建解析A/AAAA记录的DNS发现，节点使用相同的端口
+func NewHost(name string, port int) *DNS {
+	return &DNS{Name: name, Port: port}
+}
+
+func (d *DNS) resolver() Resolver {
+	if d.Resolver == nil {
+		return net.DefaultResolver
+	}
+	return d.Resolver
+}
+
+//节点地址，主机名去掉末尾的点
+func (d *DNS) addr(host string, port int) string {
+	scheme := d.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	return scheme + "://" + net.JoinHostPort(strings.TrimSuffix(host, "."), strconv.Itoa(port))
+}
+
+// Peers 解析一次，按地址排序返回
+func (d *DNS) Peers(ctx context.Context) ([]ppcache.Peer, error) {
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = defaultDNSTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var peers []ppcache.Peer
+	if d.SRV {
+		_, records, err := d.resolver().LookupSRV(ctx, "", "", d.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			peers = append(peers, ppcache.Peer{Addr: d.addr(r.Target, int(r.Port)), Weight: 1})
+		}
+	} else {
+		if d.Port == 0 {
+			return nil, errors.New("discovery: port is required for A/AAAA lookups")
+		}
+		hosts, err := d.resolver().LookupHost(ctx, d.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, host := range hosts {
+			peers = append(peers, ppcache.Peer{Addr: d.addr(host, d.Port), Weight: 1})
+		}
+	}
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("no records for %s", d.Name)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Addr < peers[j].Addr })
+	return peers, nil
+}
+
+//下一次解析前等待的时间
+func (d *DNS) nextInterval() time.Duration {
+	interval := d.Interval
+	if interval <= 0 {
+		interval = defaultDNSInterval
+	}
+	jitter := d.Jitter
+	if jitter == 0 {
+		jitter = defaultDNSJitter
+	}
+	if jitter < 0 {
+		return interval
+	}
+	//在 [1-jitter, 1+jitter) 倍之间均匀分布
+	return time.Duration(float64(interval) * (1 + jitter*(2*rand.Float64()-1)))
+}
+
+// Watch 首次解析成功后开始定期解析，结果变化时发送新的列表
+func (d *DNS) Watch(ctx context.Context) (<-chan []ppcache.Peer, error) {
+	peers, err := d.Peers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %v", d.Name, err)
+	}
+	logf := d.Logf
+	if logf == nil {
+		logf = log.Printf
+	}
+	ch := make(chan []ppcache.Peer, 1)
+	ch <- peers
+	go func() {
+		defer close(ch)
+		last := peers
+		timer := time.NewTimer(d.nextInterval())
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+			timer.Reset(d.nextInterval())
+			peers, err := d.Peers(ctx)
+			if err != nil {
+				logf("[discovery] keeping previous peers, resolving %s: %v", d.Name, err)
+				continue
+			}
+			if samePeers(peers, last) {
+				continue
+			}
+			last = peers
+			select {
+			case ch <- peers:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+var _ Discovery = (*DNS)(nil)
+var _ Resolver = (*net.Resolver)(nil)
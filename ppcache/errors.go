@@ -0,0 +1,151 @@
+// Package ppcache
+// @author    : MuXiang123
+// @time      : 2026/10/19 12:41
+// 可以跨节点传递的错误类型
+package ppcache
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	pb "ppcache/ppcachepb"
+)
+
+var (
+	// ErrNotFound 数据源中不存在该key，Getter可以返回包装了它的错误
+	ErrNotFound = errors.New("ppcache: not found")
+	// ErrTooManyRequests 节点过载，拒绝了请求
+	ErrTooManyRequests = errors.New("ppcache: too many requests")
+	// ErrUnavailable 节点暂时无法提供服务
+	ErrUnavailable = errors.New("ppcache: unavailable")
+	// ErrBadRequest 请求不合法，例如key为空
+	ErrBadRequest = errors.New("ppcache: bad request")
+	// ErrConflict CompareAndSet时key当前的版本与期望的版本不一致
+	ErrConflict = errors.New("ppcache: version conflict")
+	// ErrPermissionDenied 节点拒绝了没有权限的请求，例如未配置Secrets时其他节点的写入
+	ErrPermissionDenied = errors.New("ppcache: permission denied")
+)
+
+//远程节点返回的错误，保留原始的错误信息，并且可以用errors.Is匹配对应的哨兵错误
+type remoteError struct {
+	code     pb.Code
+	message  string
+	redirect string //MOVED和ASK时应该访问的节点
+}
+
+func (e *remoteError) Error() string {
+	return e.message
+}
+
+func (e *remoteError) Unwrap() error {
+	switch e.code {
+	case pb.Code_NOT_FOUND:
+		return ErrNotFound
+	case pb.Code_TOO_MANY_REQUESTS:
+		return ErrTooManyRequests
+	case pb.Code_UNAVAILABLE:
+		return ErrUnavailable
+	case pb.Code_BAD_REQUEST:
+		return ErrBadRequest
+	case pb.Code_CONFLICT:
+		return ErrConflict
+	case pb.Code_PERMISSION_DENIED:
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+//哈希槽不由当前节点负责时返回，请求方应该到addr上重新请求
+type redirectError struct {
+	ask  bool //槽正在迁移，只有本次请求到addr上重试
+	slot int
+	addr string
+}
+
+func (e *redirectError) Error() string {
+	if e.ask {
+		return fmt.Sprintf("ASK %d %s", e.slot, e.addr)
+	}
+	return fmt.Sprintf("MOVED %d %s", e.slot, e.addr)
+}
+
+//将错误转换为错误码
+func errorCode(err error) pb.Code {
+	var redirect *redirectError
+	switch {
+	case err == nil:
+		return pb.Code_OK
+	case errors.As(err, &redirect):
+		if redirect.ask {
+			return pb.Code_ASK
+		}
+		return pb.Code_MOVED
+	case errors.Is(err, ErrNotFound):
+		return pb.Code_NOT_FOUND
+	case errors.Is(err, ErrTooManyRequests):
+		return pb.Code_TOO_MANY_REQUESTS
+	case errors.Is(err, ErrUnavailable):
+		return pb.Code_UNAVAILABLE
+	case errors.Is(err, ErrBadRequest):
+		return pb.Code_BAD_REQUEST
+	case errors.Is(err, ErrConflict):
+		return pb.Code_CONFLICT
+	case errors.Is(err, ErrPermissionDenied):
+		return pb.Code_PERMISSION_DENIED
+	}
+	return pb.Code_INTERNAL
+}
+
+//错误码对应的http状态码
+func codeStatus(code pb.Code) int {
+	switch code {
+	case pb.Code_OK:
+		return http.StatusOK
+	case pb.Code_NOT_FOUND:
+		return http.StatusNotFound
+	case pb.Code_TOO_MANY_REQUESTS:
+		return http.StatusTooManyRequests
+	case pb.Code_UNAVAILABLE:
+		return http.StatusServiceUnavailable
+	case pb.Code_BAD_REQUEST:
+		return http.StatusBadRequest
+	case pb.Code_CONFLICT:
+		return http.StatusConflict
+	case pb.Code_PERMISSION_DENIED:
+		return http.StatusForbidden
+	case pb.Code_MOVED, pb.Code_ASK:
+		return http.StatusMisdirectedRequest
+	}
+	return http.StatusInternalServerError
+}
+
+//响应体不是protobuf时，根据http状态码推断错误码
+func statusCode(status int) pb.Code {
+	switch status {
+	case http.StatusOK:
+		return pb.Code_OK
+	case http.StatusNotFound:
+		return pb.Code_NOT_FOUND
+	case http.StatusTooManyRequests:
+		return pb.Code_TOO_MANY_REQUESTS
+	case http.StatusServiceUnavailable:
+		return pb.Code_UNAVAILABLE
+	case http.StatusBadRequest:
+		return pb.Code_BAD_REQUEST
+	case http.StatusConflict:
+		return pb.Code_CONFLICT
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return pb.Code_PERMISSION_DENIED
+	}
+	return pb.Code_INTERNAL
+}
+
+// StatusCode 返回错误对应的http状态码，便于在对外的接口中使用
+func StatusCode(err error) int {
+	return codeStatus(errorCode(err))
+}
+
+//远程节点给出了明确的答复，不需要再从本地加载
+func isAuthoritative(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, ErrTooManyRequests) || errors.Is(err, ErrBadRequest)
+}
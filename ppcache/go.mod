@@ -2,7 +2,6 @@ module ppcache
 
 go 1.18
 
-require (
-	github.com/golang/protobuf v1.5.2 // indirect
-	google.golang.org/protobuf v1.28.1 // indirect
-)
+require github.com/golang/protobuf v1.5.2
+
+require google.golang.org/protobuf v1.28.1 // indirect
@@ -0,0 +1,181 @@
+// Package ppcache
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// 对冲读取：owner迟迟没有响应时向下一个副本再发一个请求，使用先返回的结果
+package ppcache
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHedgePercentile = 0.95             //默认按owner延迟的p95决定等待时间
+	defaultHedgeMinDelay   = time.Millisecond //按分位数计算时的默认下限
+	latencyWindow          = 256              //每个节点保留的延迟样本数
+	minLatencySamples      = 20               //样本少于这个数时不按分位数对冲
+)
+
+// HedgeOptions 对冲读取的配置，零值字段使用默认值
+// 对冲请求只读取副本的缓存，需要同时用SetReplication设置大于1的复制因子
+type HedgeOptions struct {
+	Delay      time.Duration //等待owner响应的固定时间，为0时按owner的延迟分位数决定
+	Percentile float64       //Delay为0时使用的延迟分位数，默认0.95
+	MinDelay   time.Duration //按分位数计算时的下限，避免延迟很低时几乎每个请求都发出对冲，默认1ms
+}
+
+// SetHedging 开启对冲读取，o为nil时关闭，需要在开始提供服务之前调用
+func (g *Group) SetHedging(o *HedgeOptions) {
+	if o == nil {
+		g.hedge = nil
+		return
+	}
+	hedge := *o
+	if hedge.Percentile <= 0 || hedge.Percentile >= 1 {
+		hedge.Percentile = defaultHedgePercentile
+	}
+	if hedge.MinDelay <= 0 {
+		hedge.MinDelay = defaultHedgeMinDelay
+	}
+	g.hedge = &hedge
+}
+
+//向peer发出对冲请求前等待的时间，返回false时不对冲
+func (g *Group) hedgeDelay(peer PeerGetter) (time.Duration, bool) {
+	if g.hedge == nil || g.replication <= 1 {
+		return 0, false
+	}
+	if g.hedge.Delay > 0 {
+		return g.hedge.Delay, true
+	}
+	reporter, ok := peer.(LatencyReporter)
+	if !ok {
+		return 0, false
+	}
+	delay, ok := reporter.Latency(g.hedge.Percentile)
+	if !ok {
+		return 0, false
+	}
+	if delay < g.hedge.MinDelay {
+		delay = g.hedge.MinDelay
+	}
+	return delay, true
+}
+
+//对冲请求的结果
+type hedgeResult struct {
+	value   ByteView
+	err     error
+	primary bool //是否是发给owner的请求
+}
+
+//从peer获取，超过等待时间没有响应时向下一个副本发出只读缓存的请求，使用先成功的结果并取消另一个
+//副本没有缓存时继续等待owner的结果
+func (g *Group) getFromPeerHedged(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
+	delay, ok := g.hedgeDelay(peer)
+	replicator, isReplicator := g.peers.(PeerReplicator)
+	if !ok || !isReplicator {
+		return g.getFromPeer(ctx, peer, key)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan hedgeResult, 2)
+	go func() {
+		value, err := g.getFromPeer(ctx, peer, key)
+		results <- hedgeResult{value: value, err: err, primary: true}
+	}()
+	//有界负载模式下peer是包装过的客户端，与副本比较时使用原来的客户端
+	primary := peer
+	if b, ok := peer.(*boundedGetter); ok {
+		primary = b.httpGetter
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	hedgeAfter := timer.C
+	pending := 1
+	var primaryErr error
+	for pending > 0 {
+		select {
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				return res.value, nil
+			}
+			if res.primary {
+				primaryErr = res.err
+				//还没有发出对冲请求或者owner明确返回了错误时直接返回
+				if hedgeAfter != nil || isAuthoritative(res.err) {
+					return ByteView{}, res.err
+				}
+			}
+		case <-hedgeAfter:
+			hedgeAfter = nil
+			for _, replica := range replicator.PickReplicas(key, g.replication) {
+				if replica == primary {
+					continue
+				}
+				pending++
+				go func(replica PeerGetter) {
+					value, err := g.getFromPeer(withCachedOnly(ctx), replica, key)
+					results <- hedgeResult{value: value, err: err}
+				}(replica)
+				break
+			}
+		}
+	}
+	return ByteView{}, primaryErr
+}
+
+// LatencyReporter 记录请求延迟的PeerGetter实现这个接口，用于决定对冲请求的等待时间
+type LatencyReporter interface {
+	// Latency 返回最近成功请求的延迟的q分位数，样本不足时返回false
+	Latency(q float64) (time.Duration, bool)
+}
+
+//保存最近latencyWindow次请求的延迟
+type latencyTracker struct {
+	mu      sync.Mutex
+	samples [latencyWindow]time.Duration
+	n       int //样本数，最多latencyWindow
+	next    int //下一个样本写入的位置
+}
+
+func (l *latencyTracker) observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % latencyWindow
+	if l.n < latencyWindow {
+		l.n++
+	}
+}
+
+func (l *latencyTracker) percentile(q float64) (time.Duration, bool) {
+	l.mu.Lock()
+	if l.n < minLatencySamples {
+		l.mu.Unlock()
+		return 0, false
+	}
+	sorted := make([]time.Duration, l.n)
+	copy(sorted, l.samples[:l.n])
+	l.mu.Unlock()
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(q * float64(len(sorted)))
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i], true
+}
+
+// PeerLatency 返回最近访问addr时成功请求延迟的q分位数，可以据此调整对冲的等待时间
+func (p *HTTPPool) PeerLatency(addr string, q float64) (time.Duration, bool) {
+	p.mu.Lock()
+	getter, ok := p.httpGetter[addr]
+	p.mu.Unlock()
+	if !ok {
+		return 0, false
+	}
+	return getter.Latency(q)
+}
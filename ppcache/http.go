@@ -5,39 +5,292 @@
 package ppcache
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/golang/protobuf/proto"
-	"io/ioutil"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"ppcache/consistenthash"
 	pb "ppcache/ppcachepb"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
 	defaultBasePath = "/_ppcache/" //默认基础路径
 	defaultReplicas = 50           //默认虚拟节点倍数50
+
+	defaultDialTimeout           = 2 * time.Second  //默认建立连接的超时时间
+	defaultKeepAlive             = 30 * time.Second //默认tcp keep-alive探测间隔
+	defaultTLSHandshakeTimeout   = 2 * time.Second  //默认tls握手超时时间
+	defaultResponseHeaderTimeout = 3 * time.Second  //默认等待响应头的超时时间
+	defaultTimeout               = 5 * time.Second  //默认单次请求的总超时时间
+	defaultMaxIdleConnsPerHost   = 32               //默认每个节点保持的空闲连接数
+	defaultIdleConnTimeout       = 90 * time.Second //默认空闲连接的存活时间
+	defaultReplicationQueue      = 1024             //默认最多等待推送给副本的值
+	defaultReplicationTimeout    = 5 * time.Second  //默认每次推送给副本的超时时间
 )
 
+// HTTPPoolOptions HTTPPool的配置项，零值字段使用默认值
+type HTTPPoolOptions struct {
+	BasePath string                //节点间通信地址的前缀，默认为 /_ppcache/
+	Replicas int                   //虚拟节点倍数，默认为50
+	HashFn   consistenthash.Hash   //一致性哈希使用的哈希函数，默认为crc32.ChecksumIEEE
+	HashFn64 consistenthash.Hash64 //不为nil时使用64位的哈希环，优先于HashFn
+
+	//创建节点选择算法，默认为使用Replicas和HashFn的一致性哈希环
+	//可以换成consistenthash中的Rendezvous、Jump、Maglev或哈希槽Slots
+	//Jump的映射取决于节点的添加顺序，只适合各节点用相同列表调用SetPeers的静态成员，顺序会计入哈希环指纹
+	NewPicker func() consistenthash.Picker
+	//选择节点时只使用key中被标记的部分，例如设为consistenthash.DefaultHashTag后
+	//user:{42}:profile 和 user:{42}:scores 落在同一个节点上；零值表示使用整个key
+	//所有节点需要使用相同的分隔符
+	HashTag consistenthash.HashTag
+	//大于0时开启有界负载：每个节点最多承担平均负载的(1+BoundedLoad)倍，按权重分配，超出时顺时针交给下一个节点
+	//负载是本节点发往各节点的未完成请求数；只在默认的哈希环上生效，ReadReplicas大于1时不生效
+	BoundedLoad float64
+
+	//当前节点所在的可用区，为空时使用SetPeers中自己的Zone
+	Zone string
+	//大于1时key的前ReadReplicas个副本都可以提供读取，优先访问同一可用区的副本以减少跨区流量
+	//副本未命中时从owner获取并保存，写入和失效会同步给所有读副本
+	//副本按可用区和机架分散，各节点的配置需要一致；哈希槽模式下不生效
+	ReadReplicas int
+
+	DialTimeout           time.Duration //建立tcp连接的超时时间
+	KeepAlive             time.Duration //tcp keep-alive探测间隔，小于0表示关闭
+	TLSHandshakeTimeout   time.Duration //tls握手的超时时间
+	ResponseHeaderTimeout time.Duration //发出请求后等待响应头的超时时间
+	Timeout               time.Duration //单次请求的总超时时间，包含读取响应体
+	MaxIdleConnsPerHost   int           //每个节点保持的最大空闲连接数
+	IdleConnTimeout       time.Duration //空闲连接的存活时间
+	DisableKeepAlives     bool          //为true时每次请求都新建连接
+
+	TLS *TLSOptions //不为nil时节点间使用https通信，节点地址也应使用https://
+
+	Secrets      [][]byte      //节点间共享的HMAC密钥，不为空时对请求签名并验签，第一个用于签名，其余只用于验签以便轮换
+	MaxClockSkew time.Duration //签名允许的时钟偏差，同时是防重放的时间窗口，默认30秒
+	//未配置Secrets时默认拒绝其他节点的写入和失效，为true时接受，只应在可信的网络中使用
+	AllowUnauthenticatedWrites bool
+
+	//一个请求最多经过的节点数，达到后收到请求的节点直接从本地加载，避免成员列表不一致时请求循环转发
+	//默认为2，即允许成员列表过期的节点再转发一次；设为1时节点收到的请求都不再转发
+	MaxHops int
+	//为true时请求方的哈希环指纹与本节点不一致时不再转发，直接从本地加载
+	StrictRing bool
+
+	ReplicationQueue   int           //等待推送给副本的值的上限，队列满时丢弃新的推送，默认1024
+	ReplicationTimeout time.Duration //每次推送给副本的超时时间，默认5秒
+
+	Rebalance *RebalanceOptions //不为nil时成员变化后把不再属于本节点的缓存推给新的owner，接收方只接受签名的推送，需要配置Secrets
+}
+
+//填充未设置的配置项
+func (o *HTTPPoolOptions) setDefaults() {
+	if o.BasePath == "" {
+		o.BasePath = defaultBasePath
+	}
+	if o.Replicas == 0 {
+		o.Replicas = defaultReplicas
+	}
+	if o.DialTimeout == 0 {
+		o.DialTimeout = defaultDialTimeout
+	}
+	if o.KeepAlive == 0 {
+		o.KeepAlive = defaultKeepAlive
+	}
+	if o.TLSHandshakeTimeout == 0 {
+		o.TLSHandshakeTimeout = defaultTLSHandshakeTimeout
+	}
+	if o.ResponseHeaderTimeout == 0 {
+		o.ResponseHeaderTimeout = defaultResponseHeaderTimeout
+	}
+	if o.Timeout == 0 {
+		o.Timeout = defaultTimeout
+	}
+	if o.MaxIdleConnsPerHost == 0 {
+		o.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	if o.IdleConnTimeout == 0 {
+		o.IdleConnTimeout = defaultIdleConnTimeout
+	}
+	if o.MaxHops == 0 {
+		o.MaxHops = defaultMaxHops
+	}
+	if o.ReplicationQueue <= 0 {
+		o.ReplicationQueue = defaultReplicationQueue
+	}
+	if o.ReplicationTimeout <= 0 {
+		o.ReplicationTimeout = defaultReplicationTimeout
+	}
+	if o.NewPicker == nil {
+		replicas, fn, fn64, bounded := o.Replicas, o.HashFn, o.HashFn64, o.BoundedLoad
+		o.NewPicker = func() consistenthash.Picker {
+			var m *consistenthash.Map
+			if fn64 != nil {
+				m = consistenthash.New64(replicas, fn64)
+			} else {
+				m = consistenthash.New(replicas, fn)
+			}
+			if bounded > 0 {
+				m.SetBoundedLoad(bounded)
+			}
+			return m
+		}
+	}
+}
+
+//根据配置创建节点间通信使用的http客户端，每个HTTPPool独享一个Transport
+//certs不为nil时使用https，由certs按拨号的地址校验服务端证书
+func newHTTPClient(o *HTTPPoolOptions, certs *certStore) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   o.DialTimeout,
+		KeepAlive: o.KeepAlive,
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   o.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: o.ResponseHeaderTimeout,
+		MaxIdleConns:          0, //总数不限制，由MaxIdleConnsPerHost约束每个节点
+		MaxIdleConnsPerHost:   o.MaxIdleConnsPerHost,
+		IdleConnTimeout:       o.IdleConnTimeout,
+		DisableKeepAlives:     o.DisableKeepAlives,
+		ForceAttemptHTTP2:     certs != nil,
+	}
+	if certs != nil {
+		transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return certs.dialTLS(ctx, dialer, network, addr, o.TLSHandshakeTimeout)
+		}
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   o.Timeout,
+	}
+}
+
+//复用读取响应体的缓冲区，减少内存分配
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+//超过这个容量的缓冲区不再放回池中，避免一次很大的响应长期占用内存
+const maxPooledBuffer = 64 << 10
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
 // HTTPPool HTTP通信的数据结构
 type HTTPPool struct {
+	mismatches uint64 //哈希环指纹不一致的请求数，放在第一个字段以保证原子操作的对齐
+	handingOff int32  //不为0时正在下线交接，成员变化不再触发自动迁移
 	//节点的url：https://example.net:8000
 	self       string                 //主机/ip和端口号
 	basePath   string                 //节点间通信地址的前缀
 	mu         sync.Mutex             //互斥锁
-	peers      *consistenthash.Map    //根据具体的key 选择节点
+	peers      consistenthash.Picker  //根据具体的key 选择节点
 	httpGetter map[string]*httpGetter //映射远程节点和对应的httpGetter key : http://10.0.0.2:8008
+	members    map[string]Peer        //当前的节点
+	departed   map[string]time.Time   //最近离开的节点和离开的时间
+	version    uint64                 //节点变更的次数
+	view       atomic.Value           //最近一次变更后的*Membership
+	opts       HTTPPoolOptions        //配置项
+	client     *http.Client           //访问远程节点的http客户端，所有httpGetter共用
+	certs      *certStore             //tls证书，未启用tls时为nil
+	auth       *authenticator         //请求签名，未配置密钥时为nil
+	rebalance  chan struct{}          //通知迁移协程成员发生了变化，未启用迁移时为nil
+	balancing  sync.Mutex             //串行化迁移，自动迁移与下线时的交接不会同时推送同一批key
+	pushes     replicationQueue       //等待推送给副本的值
 }
 
 // NewHTTPPool 初始化服务端数据
 func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
-		self:     self,
-		basePath: defaultBasePath,
+	return NewHTTPPoolOpts(self, nil)
+}
+
+// NewHTTPPoolOpts 使用自定义配置初始化服务端数据，o为nil时使用默认配置
+func NewHTTPPoolOpts(self string, o *HTTPPoolOptions) *HTTPPool {
+	p := &HTTPPool{self: self}
+	if o != nil {
+		p.opts = *o
+	}
+	p.opts.setDefaults()
+	p.basePath = p.opts.BasePath
+	if p.opts.TLS != nil {
+		p.certs = newCertStore(*p.opts.TLS)
+		if err := p.certs.reload(); err != nil {
+			p.Log("loading tls certificates: %v", err)
+		}
+	}
+	p.client = newHTTPClient(&p.opts, p.certs)
+	p.httpGetter = make(map[string]*httpGetter)
+	p.members = make(map[string]Peer)
+	p.departed = make(map[string]time.Time)
+	p.view.Store(&Membership{})
+	if len(p.opts.Secrets) > 0 {
+		p.auth = newAuthenticator(p.opts.Secrets, p.opts.MaxClockSkew)
+	} else if !p.opts.AllowUnauthenticatedWrites {
+		p.Log("WARNING: no Secrets configured, peer writes, invalidations, replication and handoff to this node will be refused; " +
+			"configure Secrets on every node, or set AllowUnauthenticatedWrites on a trusted network")
+	}
+	if p.opts.Rebalance != nil {
+		rebalance := *p.opts.Rebalance
+		rebalance.setDefaults()
+		p.opts.Rebalance = &rebalance
+		p.rebalance = make(chan struct{}, 1)
+		go p.rebalanceLoop()
+	}
+	return p
+}
+
+// TLSConfig 返回节点服务端使用的tls配置，未启用tls时返回nil
+func (p *HTTPPool) TLSConfig() *tls.Config {
+	if p.certs == nil {
+		return nil
+	}
+	return p.certs.serverConfig()
+}
+
+// ReloadCertificates 从磁盘重新加载证书，之后的握手都会使用新证书，失败时保留原来的证书
+func (p *HTTPPool) ReloadCertificates() error {
+	if p.certs == nil {
+		return errors.New("ppcache: tls is not enabled")
+	}
+	return p.certs.reload()
+}
+
+// ListenAndServe 在self对应的地址上启动节点服务，启用tls时使用https
+// 无法停止，需要优雅退出时使用Server
+func (p *HTTPPool) ListenAndServe() error {
+	u, err := url.Parse(p.self)
+	if err != nil {
+		return fmt.Errorf("parsing self address: %v", err)
+	}
+	srv := &http.Server{
+		Addr:      u.Host,
+		Handler:   p,
+		TLSConfig: p.TLSConfig(),
 	}
+	if srv.TLSConfig == nil {
+		return srv.ListenAndServe()
+	}
+	if err := p.ReloadCertificates(); err != nil {
+		return err
+	}
+	return srv.ListenAndServeTLS("", "")
 }
 
 //Log 带有服务器名称的信息
@@ -52,29 +305,67 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		panic("HTTPPool serving unexpected path: " + r.URL.Path)
 	}
 	p.Log("%s, %s", r.Method, r.URL.Path)
+	//校验请求签名，只有持有共享密钥的节点才能访问
+	if p.auth != nil {
+		if err := p.auth.verify(r); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
 	//判断是否存在groupName和key，约定访问路径为/<basepath>/<groupname>/<key>
 	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2)
 	if len(parts) != 2 {
-		http.Error(w, "bad request", http.StatusBadRequest)
+		writeError(w, ErrBadRequest)
 		return
 	}
 
 	groupName := parts[0]
 	key := parts[1]
+	//其他节点推送的缓存：成员变化后的迁移以及owner向副本的复制
+	if groupName == bulkPath {
+		p.serveBulk(w, r, key)
+		return
+	}
 
 	//通过groupName得到group实例
 	group := GetGroup(groupName)
 	if group == nil {
-		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
+		writeError(w, fmt.Errorf("no such group: %s: %w", groupName, ErrNotFound))
+		return
+	}
+	//来自其他节点的请求带有经过的节点数，达到上限或哈希环不一致时不再转发
+	hops, _ := strconv.Atoi(r.Header.Get(hopsHeader))
+	forward := hops < p.opts.MaxHops
+	if !p.checkRing(r) && p.opts.StrictRing {
+		forward = false
+	}
+	//其他节点发来的写入和失效
+	if r.Method == http.MethodPut || r.Method == http.MethodDelete {
+		p.serveWrite(w, r, group, key, hops, forward)
 		return
 	}
-	view, err := group.Get(key)
+	var view ByteView
+	var err error
+	//owner不可用时请求方从副本读取，只返回缓存中的值
+	if r.Header.Get(cachedOnlyHeader) != "" {
+		view, err = group.getCached(key)
+	} else if slots := p.SlotTable(); slots != nil && key != "" {
+		//哈希槽模式下由槽表决定是否处理该请求
+		view, err = p.getSlot(slots, r, group, key)
+	} else if forward && r.Header.Get(askingHeader) == "" {
+		view, err = group.GetContext(withHops(r.Context(), hops), key)
+	} else {
+		view, err = group.getLocal(key)
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		//错误码和原始信息一起返回，请求方据此还原出对应的错误
+		writeError(w, err)
 		return
 	}
-	// 将value 写入响应体中，
-	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice()})
+	// 将value和过期时间、版本等元数据写入响应体中，
+	res := &pb.Response{}
+	view.toResponse(res)
+	body, err := proto.Marshal(res)
 	//查缓存
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -86,68 +377,288 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Write(body)
 }
 
+//处理写入和失效，PUT的请求体是protobuf编码的SetRequest，本节点是owner时同步给副本
+//写入成功时响应体中是保存的值的版本等元数据，不包含值本身
+func (p *HTTPPool) serveWrite(w http.ResponseWriter, r *http.Request, group *Group, key string, hops int, forward bool) {
+	if p.auth == nil && !p.opts.AllowUnauthenticatedWrites {
+		writeError(w, fmt.Errorf("writes require signed requests, configure Secrets: %w", ErrPermissionDenied))
+		return
+	}
+	if key == "" {
+		writeError(w, fmt.Errorf("key is require: %w", ErrBadRequest))
+		return
+	}
+	var view *ByteView
+	var expect *uint64
+	if r.Method == http.MethodPut {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBulkEntry))
+		req := &pb.SetRequest{}
+		if err == nil {
+			err = proto.Unmarshal(body, req)
+		}
+		if err != nil {
+			writeError(w, fmt.Errorf("decoding value: %v: %w", err, ErrBadRequest))
+			return
+		}
+		v := viewFromResponse(req.GetValue())
+		view = &v
+		if req.Compare {
+			expect = &req.Version
+		}
+	}
+	version, err := group.applyRemote(withHops(r.Context(), hops), key, view, expect, forward)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	res := &pb.Response{Version: version}
+	if view != nil {
+		res.ExpireAt, res.CreatedAt, res.Flags = unixNano(view.expire), unixNano(view.created), view.flags
+	}
+	body, err := proto.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(body)
+}
+
+//将错误编码为protobuf响应，http状态码由错误类型决定
+func writeError(w http.ResponseWriter, err error) {
+	code := errorCode(err)
+	res := &pb.Response{Code: code, Message: err.Error()}
+	var redirect *redirectError
+	if errors.As(err, &redirect) {
+		res.Redirect = redirect.addr
+	}
+	body, mErr := proto.Marshal(res)
+	if mErr != nil {
+		http.Error(w, err.Error(), codeStatus(code))
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(codeStatus(code))
+	w.Write(body)
+}
+
 //客户端
 type httpGetter struct {
 	baseURL string
+	client  *http.Client
+	auth    *authenticator
+	pool    *HTTPPool       //所属的HTTPPool，用于跟随重定向并更新槽表，可以为nil
+	latency *latencyTracker //最近成功请求的延迟，可以为nil
+}
+
+// Latency 返回最近成功请求的延迟的q分位数，样本不足时返回false
+func (h *httpGetter) Latency(q float64) (time.Duration, bool) {
+	if h.latency == nil {
+		return 0, false
+	}
+	return h.latency.percentile(q)
 }
 
 // Get 从远程节点中获取缓存,使用proto.Unmarshal() 解码 HTTP 响应
 func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
+	return h.GetContext(context.Background(), in, out)
+}
+
+// GetContext 与Get相同，ctx取消时中止请求
+func (h *httpGetter) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return h.do(ctx, http.MethodGet, in, nil, out)
+}
+
+// Set 在远程节点上写入key，值中的过期时间等元数据一起写入，set.Compare为true时由对方比较版本
+func (h *httpGetter) Set(ctx context.Context, in *pb.Request, set *pb.SetRequest, out *pb.Response) error {
+	body, err := proto.Marshal(set)
+	if err != nil {
+		return err
+	}
+	return h.do(ctx, http.MethodPut, in, body, out)
+}
+
+// Invalidate 删除远程节点上key的缓存
+func (h *httpGetter) Invalidate(ctx context.Context, in *pb.Request) error {
+	return h.do(ctx, http.MethodDelete, in, nil, &pb.Response{})
+}
+
+//发出请求，哈希槽模式下跟随MOVED和ASK重定向，MOVED同时更新本地的槽表
+func (h *httpGetter) do(ctx context.Context, method string, in *pb.Request, body []byte, out *pb.Response) error {
+	baseURL, asking := h.baseURL, false
+	for redirects := 0; ; redirects++ {
+		start := time.Now()
+		err := h.get(ctx, method, baseURL, asking, in, body, out)
+		if err == nil && method == http.MethodGet && h.latency != nil {
+			h.latency.observe(time.Since(start))
+		}
+		var re *remoteError
+		if !errors.As(err, &re) || re.redirect == "" || h.pool == nil || redirects == maxRedirects {
+			return err
+		}
+		//只跟随到已知节点的重定向，请求带有签名和key，不能发给响应中任意的地址
+		if !h.pool.hasPeer(re.redirect) {
+			h.pool.Log("ignoring redirect to unknown peer %s", re.redirect)
+			return err
+		}
+		if re.code == pb.Code_MOVED {
+			h.pool.slotMoved(in.GetKey(), re.redirect)
+		}
+		//重定向到自己时交给调用方从本地加载，不能在singleflight中再请求自己
+		if re.redirect == h.pool.self {
+			return err
+		}
+		baseURL, asking = re.redirect+h.pool.basePath, re.code == pb.Code_ASK
+		out.Reset()
+	}
+}
+
+//向baseURL对应的节点发出一次请求
+func (h *httpGetter) get(ctx context.Context, method, baseURL string, asking bool, in *pb.Request, body []byte, out *pb.Response) error {
 	//打印访问远程节点的url
 	u := fmt.Sprintf(
 		"%v%v/%v",
-		h.baseURL,
+		baseURL,
 		url.QueryEscape(in.GetGroup()),
 		url.QueryEscape(in.GetKey()),
 	)
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return err
+	}
+	if asking || ctxAsking(ctx) {
+		req.Header.Set(askingHeader, "1")
+	}
+	if cachedOnly(ctx) {
+		req.Header.Set(cachedOnlyHeader, "1")
+	}
+	//携带哈希环指纹和经过的节点数，接收方据此发现成员列表不一致并避免循环转发
+	req.Header.Set(hopsHeader, strconv.Itoa(hopsFrom(ctx)+1))
+	if h.pool != nil {
+		req.Header.Set(ringHeader, formatFingerprint(h.pool.Membership().Fingerprint))
+	}
+	if h.auth != nil {
+		if err = h.auth.sign(req); err != nil {
+			return err
+		}
+	}
 	//获取返回值
-	res, err := http.Get(u)
+	res, err := h.client.Do(req)
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("server return: %v", res.Status)
-	}
-	//转换为byte类型
-	bytes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
+	//读取到池化的缓冲区中，Unmarshal会复制bytes字段，所以缓冲区可以立即归还
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer putBuffer(buf)
+	if _, err = io.Copy(buf, res.Body); err != nil {
 		return fmt.Errorf("reading response body: %v", err)
 	}
-	if err = proto.Unmarshal(bytes, out); err != nil {
+	if res.StatusCode != http.StatusOK {
+		//优先使用响应体中的错误码，不是protobuf响应时根据状态码推断
+		if res.Header.Get("Content-Type") == "application/octet-stream" &&
+			proto.Unmarshal(buf.Bytes(), out) == nil && out.Code != pb.Code_OK {
+			return &remoteError{code: out.Code, message: out.Message, redirect: out.Redirect}
+		}
+		return &remoteError{code: statusCode(res.StatusCode), message: fmt.Sprintf("server return: %v", res.Status)}
+	}
+	if err = proto.Unmarshal(buf.Bytes(), out); err != nil {
 		return fmt.Errorf("decoding response body: %v", err)
 	}
 	return nil
 }
 
-var _ PeerGetter = (*httpGetter)(nil)
+var _ ContextPeerGetter = (*httpGetter)(nil)
+var _ PeerWriter = (*httpGetter)(nil)
 
 //Set 更新节点
 func (p *HTTPPool) Set(peers ...string) {
+	weighted := make([]Peer, len(peers))
+	for i, peer := range peers {
+		weighted[i] = Peer{Addr: peer, Weight: 1}
+	}
+	p.SetPeers(weighted...)
+}
+
+// SetPeers 更新节点，每个节点的虚拟节点数与其权重成正比，适合容量不同的机器混合部署
+// 会按新的节点列表重建选择算法，仍然存在的节点继续使用原来的客户端；只增删少量节点时使用AddPeers和RemovePeers
+func (p *HTTPPool) SetPeers(peers ...Peer) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	//实例化一致性哈希算法
-	p.peers = consistenthash.New(defaultReplicas, nil)
-	p.peers.Add(peers...)
-	//为每个节点创建http客户端
-	p.httpGetter = make(map[string]*httpGetter, len(peers))
+	keep := make(map[string]bool, len(peers))
 	for _, peer := range peers {
-		p.httpGetter[peer] = &httpGetter{
-			baseURL: peer + p.basePath,
+		keep[peer.Addr] = true
+	}
+	if slots, ok := p.peers.(*consistenthash.Slots); ok {
+		//槽表可能经过显式分配和迁移，保留原来的槽表，只删除不再存在的节点
+		for _, node := range slots.Nodes() {
+			if !keep[node] {
+				slots.Remove(node)
+			}
+		}
+	} else {
+		//实例化节点选择算法，所有节点都需要重新加入
+		p.peers = p.opts.NewPicker()
+		p.members = make(map[string]Peer, len(peers))
+	}
+	for addr := range p.httpGetter {
+		if !keep[addr] {
+			delete(p.members, addr)
+			delete(p.httpGetter, addr)
+			p.depart(addr)
 		}
 	}
+	for _, peer := range peers {
+		p.addPeer(peer)
+	}
+	p.publish()
 }
 
 // PickPeer 根据key选择节点，返回节点对应的http客户端
+// 配置了ReadReplicas时优先选择与当前节点在同一可用区的副本，配置了BoundedLoad时跳过负载已满的节点
 func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+	if peer, ok, bounded := p.pickBounded(p.opts.HashTag.Extract(key)); bounded {
+		return peer, ok
+	}
+	peer := p.pickRead(p.opts.HashTag.Extract(key))
+	//本节点是读副本时未命中的key从owner获取，避免每个副本各自回源
+	if peer == p.self {
+		peer = p.peers.Get(p.opts.HashTag.Extract(key))
+	}
+	if peer != "" && peer != p.self {
 		p.Log("pick peer %s", peer)
 		return p.httpGetter[peer], true
 	}
 	return nil, false
 }
 
+// PickOwner 返回key的owner对应的客户端，不考虑读副本，本节点是owner时返回false
+func (p *HTTPPool) PickOwner(key string) (PeerGetter, bool) {
+	if owner := p.owner(key); owner != "" && owner != p.self {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if getter, ok := p.httpGetter[owner]; ok {
+			return getter, true
+		}
+	}
+	return nil, false
+}
+
+//addr是否是当前的节点
+func (p *HTTPPool) hasPeer(addr string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.httpGetter[addr]
+	return ok
+}
+
 var _ PeerPicker = (*HTTPPool)(nil)
+var _ OwnerPicker = (*HTTPPool)(nil)
@@ -0,0 +1,1970 @@
+// Package ppcache
+// @author    : MuXiang123
+// @time      : 2026/10/19 10:12
+package ppcache
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"ppcache/consistenthash"
+	pb "ppcache/ppcachepb"
+	"ppcache/singleflight"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPGetterTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	p := NewHTTPPoolOpts(srv.URL, &HTTPPoolOptions{Timeout: 50 * time.Millisecond})
+	h := &httpGetter{baseURL: srv.URL + p.basePath, client: p.client}
+	start := time.Now()
+	err := h.Get(&pb.Request{Group: "scores", Key: "Tom"}, &pb.Response{})
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("request was not cut off by the client timeout: %v", time.Since(start))
+	}
+}
+
+func TestHTTPGetterReusesBuffer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := proto.Marshal(&pb.Response{Value: []byte(r.URL.Path)})
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	p := NewHTTPPoolOpts(srv.URL, nil)
+	h := &httpGetter{baseURL: srv.URL + p.basePath, client: p.client}
+	first := &pb.Response{}
+	if err := h.Get(&pb.Request{Group: "scores", Key: "Tom"}, first); err != nil {
+		t.Fatal(err)
+	}
+	second := &pb.Response{}
+	if err := h.Get(&pb.Request{Group: "scores", Key: "Jack"}, second); err != nil {
+		t.Fatal(err)
+	}
+	//第二次请求复用了缓冲区，第一次的结果不能被覆盖
+	if string(first.Value) != "/_ppcache/scores/Tom" || string(second.Value) != "/_ppcache/scores/Jack" {
+		t.Fatalf("unexpected values %q %q", first.Value, second.Value)
+	}
+}
+
+//测试用的证书，由进程内生成的CA签发
+type testCerts struct {
+	dir      string
+	caPEM    []byte
+	caCert   *x509.Certificate
+	caKey    *ecdsa.PrivateKey
+	serial   int64
+	certFile string
+	keyFile  string
+	caFile   string
+}
+
+func newTestCerts(t *testing.T) *testCerts {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ppcache test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(der)
+	c := &testCerts{dir: t.TempDir(), caCert: ca, caKey: key, serial: 1}
+	c.caPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	c.caFile = filepath.Join(c.dir, "ca.pem")
+	if err := os.WriteFile(c.caFile, c.caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// issue 签发一张节点证书并写入name.pem/name-key.pem，返回证书的序列号
+// 证书中的主机名或IP为hosts，没有指定时为127.0.0.1
+func (c *testCerts) issue(t *testing.T, name string, hosts ...string) (certFile, keyFile string, serial int64) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(c.serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if len(hosts) == 0 {
+		hosts = []string{"127.0.0.1"}
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, c.caCert, &key.PublicKey, c.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(c.dir, name+".pem")
+	keyFile = filepath.Join(c.dir, name+"-key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, c.serial
+}
+
+//启动一个https节点，返回节点地址
+func startTLSPeer(t *testing.T, o *HTTPPoolOptions) (*HTTPPool, string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	self := "https://" + ln.Addr().String()
+	p := NewHTTPPoolOpts(self, o)
+	srv := &http.Server{Handler: p, TLSConfig: p.TLSConfig()}
+	go srv.ServeTLS(ln, "", "")
+	t.Cleanup(func() { srv.Close() })
+	return p, self
+}
+
+func TestHTTPPoolMutualTLS(t *testing.T) {
+	NewGroup("tls", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v-" + key), nil
+	}))
+	certs := newTestCerts(t)
+	serverCert, serverKey, _ := certs.issue(t, "server")
+	_, self := startTLSPeer(t, &HTTPPoolOptions{TLS: &TLSOptions{
+		CertFile:   serverCert,
+		KeyFile:    serverKey,
+		CAFile:     certs.caFile,
+		ClientAuth: true,
+	}})
+
+	clientCert, clientKey, _ := certs.issue(t, "client")
+	client := NewHTTPPoolOpts("https://127.0.0.1:1", &HTTPPoolOptions{TLS: &TLSOptions{
+		CertFile: clientCert,
+		KeyFile:  clientKey,
+		CAFile:   certs.caFile,
+	}})
+	client.Set(self)
+	peer, ok := client.PickPeer("Tom")
+	if !ok {
+		t.Fatal("expected remote peer")
+	}
+	res := &pb.Response{}
+	if err := peer.Get(&pb.Request{Group: "tls", Key: "Tom"}, res); err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Value) != "v-Tom" {
+		t.Fatalf("got %q", res.Value)
+	}
+
+	//没有客户端证书的节点不能读取缓存
+	anonymous := NewHTTPPoolOpts("https://127.0.0.1:1", &HTTPPoolOptions{TLS: &TLSOptions{CAFile: certs.caFile}})
+	anonymous.Set(self)
+	peer, _ = anonymous.PickPeer("Tom")
+	if err := peer.Get(&pb.Request{Group: "tls", Key: "Tom"}, &pb.Response{}); err == nil {
+		t.Fatal("expected request without client certificate to fail")
+	}
+
+	//其他CA签发的证书同样被拒绝
+	other := newTestCerts(t)
+	otherCert, otherKey, _ := other.issue(t, "intruder")
+	intruder := NewHTTPPoolOpts("https://127.0.0.1:1", &HTTPPoolOptions{TLS: &TLSOptions{
+		CertFile: otherCert,
+		KeyFile:  otherKey,
+		CAFile:   certs.caFile,
+	}})
+	intruder.Set(self)
+	peer, _ = intruder.PickPeer("Tom")
+	if err := peer.Get(&pb.Request{Group: "tls", Key: "Tom"}, &pb.Response{}); err == nil {
+		t.Fatal("expected certificate from unknown ca to be rejected")
+	}
+}
+
+func TestHTTPPoolVerifiesPeerAddress(t *testing.T) {
+	NewGroup("tls-name", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v-" + key), nil
+	}))
+	//同一个CA签发、但不包含节点IP的证书
+	certs := newTestCerts(t)
+	certFile, keyFile, _ := certs.issue(t, "evil", "evil.example")
+	_, self := startTLSPeer(t, &HTTPPoolOptions{TLS: &TLSOptions{CertFile: certFile, KeyFile: keyFile}})
+	get := func(o *TLSOptions) error {
+		client := NewHTTPPoolOpts("https://127.0.0.1:1", &HTTPPoolOptions{TLS: o})
+		client.Set(self)
+		peer, _ := client.PickPeer("Tom")
+		return peer.Get(&pb.Request{Group: "tls-name", Key: "Tom"}, &pb.Response{})
+	}
+	if err := get(&TLSOptions{CAFile: certs.caFile}); err == nil {
+		t.Fatal("a certificate without the peer's IP was accepted")
+	}
+	//显式配置的ServerName优先于节点地址
+	if err := get(&TLSOptions{CAFile: certs.caFile, ServerName: "evil.example"}); err != nil {
+		t.Fatalf("certificate matching ServerName: %v", err)
+	}
+}
+
+func TestHTTPPoolReloadCertificates(t *testing.T) {
+	certs := newTestCerts(t)
+	certFile, keyFile, firstSerial := certs.issue(t, "server")
+	p, self := startTLSPeer(t, &HTTPPoolOptions{TLS: &TLSOptions{CertFile: certFile, KeyFile: keyFile}})
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(certs.caPEM)
+	serial := func() int64 {
+		conn, err := tls.Dial("tcp", self[len("https://"):], &tls.Config{RootCAs: roots})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+	}
+	if got := serial(); got != firstSerial {
+		t.Fatalf("serial = %d, want %d", got, firstSerial)
+	}
+
+	//覆盖证书文件后重新加载，新的连接使用新证书
+	_, _, secondSerial := certs.issue(t, "server")
+	if err := p.ReloadCertificates(); err != nil {
+		t.Fatal(err)
+	}
+	if got := serial(); got != secondSerial {
+		t.Fatalf("serial after reload = %d, want %d", got, secondSerial)
+	}
+
+	//重载失败时继续使用原来的证书
+	os.WriteFile(keyFile, []byte("broken"), 0600)
+	if err := p.ReloadCertificates(); err == nil {
+		t.Fatal("expected reload of broken key to fail")
+	}
+	if got := serial(); got != secondSerial {
+		t.Fatalf("serial after failed reload = %d, want %d", got, secondSerial)
+	}
+}
+
+func TestHTTPPoolSignedRequests(t *testing.T) {
+	NewGroup("signed", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v-" + key), nil
+	}))
+	oldSecret, newSecret := []byte("old-secret"), []byte("new-secret")
+	server := NewHTTPPoolOpts("http://server", &HTTPPoolOptions{Secrets: [][]byte{newSecret, oldSecret}})
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	get := func(secrets [][]byte) error {
+		var o *HTTPPoolOptions
+		if secrets != nil {
+			o = &HTTPPoolOptions{Secrets: secrets}
+		}
+		client := NewHTTPPoolOpts("http://client", o)
+		client.Set(srv.URL)
+		peer, _ := client.PickPeer("Tom")
+		return peer.Get(&pb.Request{Group: "signed", Key: "Tom"}, &pb.Response{})
+	}
+	if err := get([][]byte{newSecret}); err != nil {
+		t.Fatalf("signed request failed: %v", err)
+	}
+	//轮换期间仍持有旧密钥的节点可以访问
+	if err := get([][]byte{oldSecret}); err != nil {
+		t.Fatalf("request signed with rotated secret failed: %v", err)
+	}
+	if err := get(nil); err == nil {
+		t.Fatal("expected unsigned request to be rejected")
+	}
+	if err := get([][]byte{[]byte("guess")}); err == nil {
+		t.Fatal("expected request with unknown secret to be rejected")
+	}
+}
+
+func TestAuthenticatorRejectsReplay(t *testing.T) {
+	a := newAuthenticator([][]byte{[]byte("secret")}, time.Minute)
+	req := httptest.NewRequest(http.MethodGet, "/_ppcache/scores/Tom", nil)
+	if err := a.sign(req); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.verify(req); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	if err := a.verify(req); err != errReplayed {
+		t.Fatalf("replayed request: got %v, want %v", err, errReplayed)
+	}
+
+	//签名覆盖路径，修改路径后签名失效
+	other := httptest.NewRequest(http.MethodGet, "/_ppcache/scores/Jack", nil)
+	a.sign(req)
+	other.Header = req.Header
+	if err := a.verify(other); err != errBadSignature {
+		t.Fatalf("tampered path: got %v, want %v", err, errBadSignature)
+	}
+
+	//签名同样覆盖查询参数、请求体和协议请求头
+	tampered := map[string]func(r *http.Request){
+		"query":  func(r *http.Request) { r.URL.RawQuery = "from=http://evil" },
+		"body":   func(r *http.Request) { r.Body = io.NopCloser(strings.NewReader("forged")) },
+		"hops":   func(r *http.Request) { r.Header.Set(hopsHeader, "0") },
+		"ring":   func(r *http.Request) { r.Header.Set(ringHeader, "0") },
+		"asking": func(r *http.Request) { r.Header.Set(askingHeader, "1") },
+	}
+	for name, tamper := range tampered {
+		req := httptest.NewRequest(http.MethodPut, "/_ppcache/scores/Tom?from=http://a", strings.NewReader("value"))
+		req.Header.Set(hopsHeader, "1")
+		req.Header.Set(ringHeader, "abc")
+		if err := a.sign(req); err != nil {
+			t.Fatal(err)
+		}
+		tamper(req)
+		if err := a.verify(req); err != errBadSignature {
+			t.Fatalf("tampered %s: got %v, want %v", name, err, errBadSignature)
+		}
+	}
+	//验签后处理方读到的仍是完整的请求体
+	req = httptest.NewRequest(http.MethodPut, "/_ppcache/scores/Tom", strings.NewReader("value"))
+	a.sign(req)
+	if err := a.verify(req); err != nil {
+		t.Fatalf("signed PUT: %v", err)
+	}
+	if body, _ := io.ReadAll(req.Body); string(body) != "value" {
+		t.Fatalf("body after verify = %q", body)
+	}
+
+	//超出时间窗口的请求被拒绝
+	req = httptest.NewRequest(http.MethodGet, "/_ppcache/scores/Tom", nil)
+	a.now = func() time.Time { return time.Now().Add(-2 * time.Minute) }
+	a.sign(req)
+	a.now = time.Now
+	if err := a.verify(req); err != errStaleSignature {
+		t.Fatalf("stale request: got %v, want %v", err, errStaleSignature)
+	}
+}
+
+func TestHTTPPoolTypedErrors(t *testing.T) {
+	NewGroup("typed", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		switch key {
+		case "busy":
+			return nil, fmt.Errorf("db overloaded: %w", ErrTooManyRequests)
+		case "down":
+			return nil, fmt.Errorf("db maintenance: %w", ErrUnavailable)
+		}
+		return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+	}))
+	srv := httptest.NewServer(NewHTTPPool("http://owner"))
+	defer srv.Close()
+
+	//请求方的group不注册到全局，模拟另一个进程中的同名group
+	localLoads := 0
+	requester := &Group{
+		name: "typed",
+		getter: GetterFunc(func(key string) ([]byte, error) {
+			localLoads++
+			return []byte("local"), nil
+		}),
+		loader: &singleflight.Group{},
+	}
+	pool := NewHTTPPool("http://requester")
+	pool.Set(srv.URL)
+	requester.RegisterPeers(pool)
+
+	tests := []struct {
+		key    string
+		status int
+		want   error
+	}{
+		{"Tom", http.StatusNotFound, ErrNotFound},
+		{"busy", http.StatusTooManyRequests, ErrTooManyRequests},
+	}
+	for _, tt := range tests {
+		_, err := requester.Get(tt.key)
+		if !errors.Is(err, tt.want) {
+			t.Fatalf("Get(%q) error = %v, want %v", tt.key, err, tt.want)
+		}
+		if StatusCode(err) != tt.status {
+			t.Fatalf("StatusCode(%v) = %d, want %d", err, StatusCode(err), tt.status)
+		}
+	}
+	if localLoads != 0 {
+		t.Fatalf("authoritative errors should not fall back to local load, got %d loads", localLoads)
+	}
+	if got := errors.Unwrap(errorFor(t, pool, "typed", "Tom")); got != ErrNotFound {
+		t.Fatalf("remote error should unwrap to ErrNotFound, got %v", got)
+	}
+
+	//节点不可用时回退到本地加载
+	if v, err := requester.Get("down"); err != nil || v.String() != "local" || localLoads != 1 {
+		t.Fatalf("Get(down) = %q, %v, loads %d", v.String(), err, localLoads)
+	}
+}
+
+//直接访问远程节点并返回其错误
+func errorFor(t *testing.T, pool *HTTPPool, group, key string) error {
+	peer, ok := pool.PickPeer(key)
+	if !ok {
+		t.Fatal("expected remote peer")
+	}
+	err := peer.Get(&pb.Request{Group: group, Key: key}, &pb.Response{})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	return err
+}
+
+func TestHTTPPoolCarriesMetadata(t *testing.T) {
+	owner := NewGroup("meta", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v-" + key), nil
+	}))
+	owner.SetTTL(time.Minute)
+	srv := httptest.NewServer(NewHTTPPool("http://owner"))
+	defer srv.Close()
+
+	requester := &Group{
+		name:     "meta",
+		getter:   GetterFunc(func(key string) ([]byte, error) { return nil, errors.New("unexpected local load") }),
+		hotCache: cache{cacheBytes: 2 << 10},
+		loader:   &singleflight.Group{},
+	}
+	pool := NewHTTPPool("http://requester")
+	pool.Set(srv.URL)
+	requester.RegisterPeers(pool)
+
+	remote, err := requester.Get("Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := owner.Get("Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !remote.Expire().Equal(local.Expire()) || !remote.CreatedAt().Equal(local.CreatedAt()) {
+		t.Fatalf("remote copy expire=%v created=%v, owner expire=%v created=%v",
+			remote.Expire(), remote.CreatedAt(), local.Expire(), local.CreatedAt())
+	}
+
+	//hotCache中的副本使用owner的过期时间
+	expired := remote
+	expired.expire = time.Now().Add(-time.Second)
+	requester.populateCache("Jack", requester.leases.acquire("Jack"), expired, &requester.hotCache)
+	if _, ok := requester.hotCache.get("Jack"); ok {
+		t.Fatal("hot copy should expire with the owner's expiry")
+	}
+}
+
+func TestHTTPPoolSetPeersWeighted(t *testing.T) {
+	p := NewHTTPPool("http://self")
+	p.SetPeers(Peer{Addr: "http://a", Weight: 1}, Peer{Addr: "http://b", Weight: 3})
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		peer, ok := p.PickPeer(fmt.Sprintf("key%d", i))
+		if !ok {
+			t.Fatal("expected remote peer")
+		}
+		counts[peer.(*httpGetter).baseURL]++
+	}
+	a, b := counts["http://a"+defaultBasePath], counts["http://b"+defaultBasePath]
+	if b < 2*a {
+		t.Fatalf("peer with weight 3 got %d keys, peer with weight 1 got %d", b, a)
+	}
+}
+
+func TestHTTPPoolCustomPicker(t *testing.T) {
+	p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{
+		NewPicker: func() consistenthash.Picker { return consistenthash.NewRendezvous(nil) },
+	})
+	p.Set("http://a", "http://b", "http://self")
+	if _, ok := p.peers.(*consistenthash.Rendezvous); !ok {
+		t.Fatalf("expected rendezvous picker, got %T", p.peers)
+	}
+	want := consistenthash.NewRendezvous(nil)
+	want.Add("http://a", "http://b", "http://self")
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		peer, ok := p.PickPeer(key)
+		owner := want.Get(key)
+		if (owner == "http://self") == ok {
+			t.Fatalf("PickPeer(%s) ok=%v, owner %s", key, ok, owner)
+		}
+		if ok && peer.(*httpGetter).baseURL != owner+defaultBasePath {
+			t.Fatalf("PickPeer(%s) = %s, want %s", key, peer.(*httpGetter).baseURL, owner)
+		}
+	}
+}
+
+func TestAdminPlan(t *testing.T) {
+	p := NewHTTPPool("http://a")
+	p.Set("http://a", "http://b", "http://c")
+	srv := httptest.NewServer(p.AdminHandler())
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/plan?add=http://d%3D2&remove=http://b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var plan consistenthash.Plan
+	if err := json.NewDecoder(res.Body).Decode(&plan); err != nil {
+		t.Fatal(err)
+	}
+	if plan.Fraction <= 0 || plan.Fraction >= 1 {
+		t.Fatalf("unexpected fraction %v", plan.Fraction)
+	}
+	for _, mv := range plan.Moves {
+		//只有b的key会离开，只有d会接收key
+		if mv.From != "http://b" && mv.To != "http://d" {
+			t.Errorf("unexpected move %s -> %s", mv.From, mv.To)
+		}
+	}
+	//预演不改变当前的环
+	if peer, ok := p.PickPeer("key"); ok && peer.(*httpGetter).baseURL == "http://d"+defaultBasePath {
+		t.Error("planning must not change membership")
+	}
+
+	rendezvous := NewHTTPPoolOpts("http://a", &HTTPPoolOptions{
+		NewPicker: func() consistenthash.Picker { return consistenthash.NewRendezvous(nil) },
+	})
+	rendezvous.Set("http://a")
+	if _, err := rendezvous.PlanChange(nil, []string{"http://a"}); err == nil {
+		t.Error("expected planning to be unsupported for rendezvous hashing")
+	}
+}
+
+func TestHTTPPoolSlotRedirects(t *testing.T) {
+	NewGroup("slotted", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v-" + key), nil
+	}))
+	opts := &HTTPPoolOptions{NewPicker: func() consistenthash.Picker { return consistenthash.NewSlots() }}
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	start := func() *HTTPPool {
+		var pool *HTTPPool
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			hits[pool.self]++
+			mu.Unlock()
+			pool.ServeHTTP(w, r)
+		}))
+		t.Cleanup(srv.Close)
+		pool = NewHTTPPoolOpts(srv.URL, opts)
+		return pool
+	}
+	a, b := start(), start()
+	requester := NewHTTPPoolOpts("http://requester", opts)
+	for _, p := range []*HTTPPool{a, b, requester} {
+		p.Set(a.self, b.self)
+	}
+	get := func(key string) {
+		t.Helper()
+		peer, ok := requester.PickPeer(key)
+		if !ok {
+			t.Fatal("expected remote peer")
+		}
+		res := &pb.Response{}
+		if err := peer.Get(&pb.Request{Group: "slotted", Key: key}, res); err != nil || string(res.Value) != "v-"+key {
+			t.Fatalf("Get(%s) = %q, %v", key, res.Value, err)
+		}
+	}
+	expectHits := func(wantA, wantB int) {
+		t.Helper()
+		mu.Lock()
+		defer mu.Unlock()
+		if hits[a.self] != wantA || hits[b.self] != wantB {
+			t.Fatalf("hits a=%d b=%d, want a=%d b=%d", hits[a.self], hits[b.self], wantA, wantB)
+		}
+	}
+
+	//请求方的槽表过期：a返回MOVED，请求方到b上读取并更新槽表
+	moved := consistenthash.KeySlot("Tom")
+	a.SlotTable().Assign(b.self, moved)
+	b.SlotTable().Assign(b.self, moved)
+	requester.SlotTable().Assign(a.self, moved)
+	get("Tom")
+	expectHits(1, 1)
+	if owner := requester.SlotTable().Owner(moved); owner != b.self {
+		t.Fatalf("MOVED should update the requester's table, owner is %s", owner)
+	}
+
+	//槽正在从a迁移到b：a上没有缓存的key返回ASK，请求方带着Asking标记到b上读取，槽表不变
+	migrating := consistenthash.KeySlot("Jack")
+	for _, p := range []*HTTPPool{a, b, requester} {
+		p.SlotTable().Assign(a.self, migrating)
+	}
+	a.SlotTable().Migrate(migrating, b.self)
+	b.SlotTable().Migrate(migrating, b.self)
+	get("Jack")
+	expectHits(2, 2)
+	if owner := requester.SlotTable().Owner(migrating); owner != a.self {
+		t.Fatalf("ASK must not update the requester's table, owner is %s", owner)
+	}
+	//测试中的节点共用同一个group，Jack已经在a的缓存中，a直接返回
+	get("Jack")
+	expectHits(3, 2)
+
+	//没有Asking标记时b仍然把迁移中的槽重定向回a，hash tag相同的key在同一个槽中
+	direct := &httpGetter{baseURL: b.self + defaultBasePath, client: http.DefaultClient}
+	err := direct.Get(&pb.Request{Group: "slotted", Key: "{Jack}.profile"}, &pb.Response{})
+	var re *remoteError
+	if !errors.As(err, &re) || re.code != pb.Code_MOVED || re.redirect != a.self {
+		t.Fatalf("expected MOVED to %s, got %v", a.self, err)
+	}
+
+	//不跟随到成员以外地址的重定向，返回原来的错误
+	stranger := NewHTTPPoolOpts("http://stranger", opts)
+	stranger.Set(b.self)
+	peer, _ := stranger.PickPeer("{Jack}.profile")
+	err = peer.Get(&pb.Request{Group: "slotted", Key: "{Jack}.profile"}, &pb.Response{})
+	if !errors.As(err, &re) || re.code != pb.Code_MOVED || re.redirect != a.self {
+		t.Fatalf("redirect to a non-member: %v", err)
+	}
+	expectHits(3, 4)
+
+	//自动分配的槽表收到MOVED后仍然是自动的，之后加入的节点会分到槽
+	auto := NewHTTPPoolOpts("http://auto", opts)
+	auto.Set(a.self, b.self)
+	var key string
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprintf("key%d", i); auto.SlotTable().Owner(auto.SlotTable().Slot(k)) == a.self {
+			key = k
+		}
+	}
+	slot := auto.SlotTable().Slot(key)
+	a.SlotTable().Assign(b.self, slot)
+	b.SlotTable().Assign(b.self, slot)
+	peer, _ = auto.PickPeer(key)
+	if err := peer.Get(&pb.Request{Group: "slotted", Key: key}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	if owner := auto.SlotTable().Owner(slot); owner != b.self {
+		t.Fatalf("MOVED should update the automatic table, owner is %s", owner)
+	}
+	auto.AddPeers(Peer{Addr: "http://c"})
+	owned := 0
+	for s := 0; s < consistenthash.SlotCount; s++ {
+		if auto.SlotTable().Owner(s) == "http://c" {
+			owned++
+		}
+	}
+	if owned == 0 {
+		t.Fatal("a node added after MOVED got no slots")
+	}
+}
+
+func TestHTTPPoolHashTag(t *testing.T) {
+	peers := []string{"http://a", "http://b", "http://c", "http://d"}
+	tagged := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{HashTag: consistenthash.HashTag{Open: "[", Close: "]"}})
+	tagged.Set(peers...)
+	plain := NewHTTPPool("http://self")
+	plain.Set(peers...)
+
+	split := false
+	for i := 0; i < 100; i++ {
+		profile, scores := fmt.Sprintf("user:[%d]:profile", i), fmt.Sprintf("user:[%d]:scores", i)
+		p1, _ := tagged.PickPeer(profile)
+		p2, _ := tagged.PickPeer(scores)
+		if p1 != p2 {
+			t.Fatalf("%s and %s picked different peers", profile, scores)
+		}
+		p1, _ = plain.PickPeer(profile)
+		p2, _ = plain.PickPeer(scores)
+		split = split || p1 != p2
+	}
+	if !split {
+		t.Fatal("without a hash tag related keys should spread across peers")
+	}
+}
+
+func TestHTTPPoolZoneAware(t *testing.T) {
+	var peers []Peer
+	for _, zone := range []string{"az1", "az2", "az3"} {
+		for _, rack := range []string{"r1", "r2"} {
+			peers = append(peers, Peer{Addr: "http://" + zone + "-" + rack, Weight: 1, Zone: zone, Rack: rack})
+		}
+	}
+	//调用方不在节点列表中，只声明自己所在的可用区
+	p := NewHTTPPoolOpts("http://client", &HTTPPoolOptions{Zone: "az2", ReadReplicas: 3})
+	p.SetPeers(peers...)
+	zoneOf := func(addr string) string {
+		return strings.SplitN(strings.TrimPrefix(addr, "http://"), "-", 2)[0]
+	}
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("key%d", i)
+		replicas := p.ReplicaPeers(key, 3)
+		zones := make(map[string]bool)
+		for _, node := range replicas {
+			zones[zoneOf(node)] = true
+		}
+		if len(replicas) != 3 || len(zones) != 3 {
+			t.Fatalf("replicas of %s = %v, want one per zone", key, replicas)
+		}
+		peer, ok := p.PickPeer(key)
+		if !ok {
+			t.Fatal("expected remote peer")
+		}
+		if got := zoneOf(peer.(*httpGetter).baseURL); got != "az2" {
+			t.Fatalf("PickPeer(%s) chose zone %s, want the caller's zone", key, got)
+		}
+	}
+
+	//自己是owner时从本地加载，是其他副本时未命中的key从owner获取，Zone从自己的Peer中获得
+	self := NewHTTPPoolOpts(peers[0].Addr, &HTTPPoolOptions{ReadReplicas: 3})
+	self.SetPeers(peers...)
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("key%d", i)
+		replicas := self.ReplicaPeers(key, 3)
+		peer, remote := self.PickPeer(key)
+		local, replica := false, false
+		for j, node := range replicas {
+			local = local || (j == 0 && node == peers[0].Addr)
+			replica = replica || (j > 0 && node == peers[0].Addr)
+		}
+		if local == remote || replica != self.ReadReplica(key) {
+			t.Fatalf("key %s: replicas %v, remote pick %v", key, replicas, remote)
+		}
+		if replica && peer.(*httpGetter).baseURL != replicas[0]+defaultBasePath {
+			t.Fatalf("key %s: read replica picked %s, want the owner %s", key, peer.(*httpGetter).baseURL, replicas[0])
+		}
+	}
+}
+
+func TestHTTPPoolIncrementalPeers(t *testing.T) {
+	p := NewHTTPPool("http://self")
+	p.Set("http://a", "http://b")
+	v1 := p.Membership()
+	if len(v1.Peers) != 2 {
+		t.Fatalf("membership %+v", v1)
+	}
+	getterA := p.httpGetter["http://a"]
+
+	p.AddPeers(Peer{Addr: "http://c", Weight: 2, Zone: "az1"})
+	v2 := p.Membership()
+	if v2.Version != v1.Version+1 || len(v2.Peers) != 3 || v2.Peers[2] != (Peer{Addr: "http://c", Weight: 2, Zone: "az1"}) {
+		t.Fatalf("membership after AddPeers %+v", v2)
+	}
+	if p.httpGetter["http://a"] != getterA {
+		t.Fatal("AddPeers must keep existing clients")
+	}
+	//旧的视图不受之后变更的影响
+	if len(v1.Peers) != 2 {
+		t.Fatalf("old view changed: %+v", v1)
+	}
+
+	p.RemovePeers("http://b", "http://unknown")
+	v3 := p.Membership()
+	if v3.Version != v2.Version+1 || len(v3.Peers) != 2 {
+		t.Fatalf("membership after RemovePeers %+v", v3)
+	}
+	for i := 0; i < 1000; i++ {
+		if peer, ok := p.PickPeer(fmt.Sprintf("key%d", i)); ok && peer.(*httpGetter).baseURL == "http://b"+defaultBasePath {
+			t.Fatal("removed peer was picked")
+		}
+	}
+	if p.httpGetter["http://a"] != getterA {
+		t.Fatal("RemovePeers must keep other clients")
+	}
+
+	//并发读取时修改成员
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; ; j++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				p.PickPeer(fmt.Sprintf("key%d", j))
+				p.Membership()
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		addr := fmt.Sprintf("http://n%d", i%5)
+		p.AddPeers(Peer{Addr: addr})
+		p.RemovePeers(addr)
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestHTTPPoolRingAgreement(t *testing.T) {
+	//成员相同时指纹相同，与添加顺序无关；权重或虚拟节点倍数不同时指纹不同
+	p1, p2 := NewHTTPPool("http://a"), NewHTTPPool("http://b")
+	p1.Set("http://a", "http://b")
+	p2.Set("http://b", "http://a")
+	if p1.Membership().Fingerprint != p2.Membership().Fingerprint {
+		t.Fatal("same members should have the same fingerprint")
+	}
+	p2.SetPeers(Peer{Addr: "http://a", Weight: 2}, Peer{Addr: "http://b"})
+	p3 := NewHTTPPoolOpts("http://a", &HTTPPoolOptions{Replicas: 10})
+	p3.Set("http://a", "http://b")
+	if fp := p1.Membership().Fingerprint; fp == p2.Membership().Fingerprint || fp == p3.Membership().Fingerprint {
+		t.Fatal("weights and replicas should change the fingerprint")
+	}
+	//Jump的映射依赖添加顺序，顺序不同时指纹不同
+	jump := func(peers ...string) uint64 {
+		p := NewHTTPPoolOpts("http://a", &HTTPPoolOptions{NewPicker: func() consistenthash.Picker { return consistenthash.NewJump(nil) }})
+		p.Set(peers...)
+		return p.Membership().Fingerprint
+	}
+	if jump("http://a", "http://b") != jump("http://a", "http://b") || jump("http://a", "http://b") == jump("http://b", "http://a") {
+		t.Fatal("jump fingerprints should follow the insertion order")
+	}
+
+	var loads int32
+	NewGroup("ring", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		return []byte("local-" + key), nil
+	}))
+	//owner记录收到的请求头，直接返回结果
+	var mu sync.Mutex
+	var seen []http.Header
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Header.Clone())
+		mu.Unlock()
+		body, _ := proto.Marshal(&pb.Response{Value: []byte("owner")})
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(body)
+	}))
+	defer owner.Close()
+	b := NewHTTPPool("http://b")
+	b.Set(owner.URL)
+	GetGroup("ring").RegisterPeers(b)
+	fp := formatFingerprint(b.Membership().Fingerprint)
+
+	get := func(key string, header map[string]string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, defaultBasePath+"ring/"+key, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		b.ServeHTTP(rec, req)
+		res := &pb.Response{}
+		if err := proto.Unmarshal(rec.Body.Bytes(), res); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: %d %v", key, rec.Code, err)
+		}
+		return string(res.Value)
+	}
+
+	//客户端的请求和未达到上限的节点请求可以转发，转发时带上本节点的指纹和加一后的节点数
+	if v := get("k1", nil); v != "owner" {
+		t.Fatalf("client request got %q", v)
+	}
+	if v := get("k2", map[string]string{hopsHeader: "1", ringHeader: fp}); v != "owner" {
+		t.Fatalf("peer request got %q", v)
+	}
+	mu.Lock()
+	if len(seen) != 2 || seen[0].Get(hopsHeader) != "1" || seen[1].Get(hopsHeader) != "2" || seen[1].Get(ringHeader) != fp {
+		t.Fatalf("forwarded headers %v", seen)
+	}
+	mu.Unlock()
+	if b.RingMismatches() != 0 {
+		t.Fatalf("mismatches = %d", b.RingMismatches())
+	}
+
+	//达到最大节点数后从本地加载
+	if v := get("k3", map[string]string{hopsHeader: "2", ringHeader: fp}); v != "local-k3" {
+		t.Fatalf("request at the hop limit got %q", v)
+	}
+	//指纹不一致时计数，默认仍然转发
+	if v := get("k4", map[string]string{hopsHeader: "1", ringHeader: "bad"}); v != "owner" || b.RingMismatches() != 1 {
+		t.Fatalf("mismatched request got %q, mismatches %d", v, b.RingMismatches())
+	}
+	//StrictRing时不再转发
+	b.opts.StrictRing = true
+	if v := get("k5", map[string]string{hopsHeader: "1", ringHeader: "bad"}); v != "local-k5" || b.RingMismatches() != 2 {
+		t.Fatalf("strict mismatched request got %q, mismatches %d", v, b.RingMismatches())
+	}
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Fatalf("loads = %d, want 2", n)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) != 3 {
+		t.Fatalf("owner got %d requests, want 3", len(seen))
+	}
+}
+
+//解码批量传输的请求体
+func readBulk(t *testing.T, r *http.Request) []*pb.BulkEntry {
+	body, _ := io.ReadAll(r.Body)
+	var entries []*pb.BulkEntry
+	for len(body) > 0 {
+		size, n := binary.Uvarint(body)
+		entry := &pb.BulkEntry{}
+		if n <= 0 || proto.Unmarshal(body[n:n+int(size)], entry) != nil {
+			t.Errorf("bad bulk entry")
+			return entries
+		}
+		entries = append(entries, entry)
+		body = body[n+int(size):]
+	}
+	return entries
+}
+
+func TestHTTPPoolRebalance(t *testing.T) {
+	//新节点记录收到的key，总是返回成功
+	var mu sync.Mutex
+	received := make(map[string]string)
+	newNode := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != defaultBasePath+bulkPath+"/handoff" {
+			t.Errorf("unexpected bulk request %s %s", r.Method, r.URL.Path)
+		}
+		for _, entry := range readBulk(t, r) {
+			mu.Lock()
+			received[entry.Key] = string(entry.Value.Value)
+			mu.Unlock()
+		}
+	}))
+	defer newNode.Close()
+
+	g := NewGroup("handoff", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v-" + key), nil
+	}))
+	a := NewHTTPPoolOpts("http://a", &HTTPPoolOptions{Rebalance: &RebalanceOptions{Batch: 256, Delay: 10 * time.Millisecond}})
+	a.Set("http://a")
+	g.RegisterPeers(a)
+	for i := 0; i < 200; i++ {
+		g.Get(fmt.Sprintf("key%d", i))
+	}
+
+	//新节点加入后，属于它的key推送过去并从本地删除，其余的key保留
+	a.AddPeers(Peer{Addr: newNode.URL})
+	var moved []string
+	for i := 0; i < 200; i++ {
+		if key := fmt.Sprintf("key%d", i); a.owner(key) == newNode.URL {
+			moved = append(moved, key)
+		}
+	}
+	if len(moved) == 0 || len(moved) == 200 {
+		t.Fatalf("%d of 200 keys moved", len(moved))
+	}
+	//新节点先记录再应答，等到推送完成、本地的key也删除之后再检查
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(received)
+		mu.Unlock()
+		kept := 0
+		for _, key := range moved {
+			if _, ok := g.mainCache.get(key); ok {
+				kept++
+			}
+		}
+		if n == len(moved) && kept == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("new node received %d keys, want %d, %d still cached", n, len(moved), kept)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, key := range moved {
+		if received[key] != "v-"+key {
+			t.Fatalf("received[%s] = %q", key, received[key])
+		}
+	}
+	kept := 0
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("key%d", i)
+		_, cached := g.mainCache.get(key)
+		if _, sent := received[key]; cached == sent {
+			t.Fatalf("key %s: cached %v, sent %v", key, cached, sent)
+		}
+		if cached {
+			kept++
+		}
+	}
+	if kept+len(moved) != 200 {
+		t.Fatalf("kept %d, moved %d", kept, len(moved))
+	}
+}
+
+func TestRebalanceKeepsNewWrites(t *testing.T) {
+	g := NewGroup("handoff-race", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v-" + key), nil
+	}))
+	//新节点收到推送时，本节点上的第一个key恰好被写入了新的值
+	var written string
+	newNode := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entries := readBulk(t, r)
+		if written == "" && len(entries) > 0 {
+			written = entries[0].Key
+			g.store(written, &ByteView{b: []byte("new"), version: g.nextVersion()})
+		}
+	}))
+	defer newNode.Close()
+	p := NewHTTPPool("http://a")
+	p.Set(newNode.URL)
+	g.RegisterPeers(p)
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		g.store(key, &ByteView{b: []byte("v-" + key), version: g.nextVersion()})
+	}
+	o := &RebalanceOptions{}
+	o.setDefaults()
+	moved, err := p.rebalanceGroup(context.Background(), g, o, &pacer{rate: 1 << 30})
+	if err != nil || moved != 20 {
+		t.Fatalf("rebalanceGroup = %d, %v", moved, err)
+	}
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		v, cached := g.mainCache.get(key)
+		if key == written {
+			if !cached || v.String() != "new" {
+				t.Fatalf("the write that raced the handoff was dropped: %q, %v", v, cached)
+			}
+		} else if cached {
+			t.Fatalf("%s was pushed but kept", key)
+		}
+	}
+}
+
+func TestHTTPPoolServeBulk(t *testing.T) {
+	g := NewGroup("handoff-in", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}))
+	secrets := [][]byte{[]byte("secret")}
+	b := NewHTTPPoolOpts("http://b", &HTTPPoolOptions{Secrets: secrets})
+	b.Set("http://b", "http://c", "http://d")
+	ownedBy := func(node string) []string {
+		var keys []string
+		for i := 0; len(keys) < 5; i++ {
+			if key := fmt.Sprintf("key%d", i); b.owner(key) == node {
+				keys = append(keys, key)
+			}
+		}
+		return keys
+	}
+	mine, theirs := ownedBy("http://b"), ownedBy("http://c")
+	signer := newAuthenticator(secrets, 0)
+	send := func(pool *HTTPPool, from string, body []byte) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, defaultBasePath+bulkPath+"/handoff-in?from="+from, bytes.NewReader(body))
+		if err := signer.sign(req); err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		pool.ServeHTTP(rec, req)
+		return rec
+	}
+	post := func(from string, keys []string, expire time.Time) int {
+		t.Helper()
+		var buf bytes.Buffer
+		for _, key := range keys {
+			writeBulkEntry(&buf, key, ByteView{b: []byte("v-" + key), expire: expire, version: 3})
+		}
+		rec := send(b, from, buf.Bytes())
+		if rec.Code != http.StatusOK {
+			t.Fatalf("bulk request: %d %s", rec.Code, rec.Body)
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(rec.Body.String()))
+		return n
+	}
+
+	//过期的值不保存
+	if n := post("http://d", mine, time.Now().Add(-time.Second)); n != 0 {
+		t.Fatalf("accepted %d expired entries", n)
+	}
+	//只保存owner是自己的key，元数据保留
+	if n := post("http://d", append(mine, theirs...), time.Time{}); n != len(mine) {
+		t.Fatalf("accepted %d entries, want %d", n, len(mine))
+	}
+	if v, ok := g.mainCache.get(mine[0]); !ok || v.String() != "v-"+mine[0] || v.Version() != 3 {
+		t.Fatalf("cached %v, %v", v, ok)
+	}
+	//下线的节点推送它自己负责的key，已经从成员列表删除后一段时间内仍然接受
+	b.RemovePeers("http://c")
+	if n := post("http://c", append(mine, theirs...), time.Time{}); n == 0 {
+		t.Fatal("rejected the handoff of a departed peer")
+	}
+
+	//未配置密钥的节点、不认识的发送方、没有签名的请求都被拒绝
+	open := NewHTTPPool("http://b")
+	open.Set("http://b", "http://c")
+	if rec := send(open, "http://c", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("bulk request to a pool without secrets: %d", rec.Code)
+	}
+	for _, from := range []string{"", "http://x", "http://b"} {
+		if rec := send(b, from, nil); rec.Code != http.StatusForbidden {
+			t.Fatalf("bulk request from %q: %d", from, rec.Code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	b.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, defaultBasePath+bulkPath+"/handoff-in?from=http://d", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unsigned bulk request: %d", rec.Code)
+	}
+
+	//截断的请求体、超过剩余预算的长度前缀和过多的key
+	if rec := send(b, "http://d", []byte("\xff")); rec.Code != http.StatusBadRequest {
+		t.Fatalf("truncated body: %d", rec.Code)
+	}
+	var prefix [binary.MaxVarintLen64]byte
+	if rec := send(b, "http://d", prefix[:binary.PutUvarint(prefix[:], maxBulkEntry+1)]); rec.Code != http.StatusBadRequest {
+		t.Fatalf("oversized entry: %d", rec.Code)
+	}
+	var buf bytes.Buffer
+	for i := 0; i <= maxBulkEntries; i++ {
+		writeBulkEntry(&buf, "x", ByteView{b: []byte("v")})
+	}
+	if rec := send(b, "http://d", buf.Bytes()); rec.Code != http.StatusBadRequest {
+		t.Fatalf("%d entries: %d", maxBulkEntries+1, rec.Code)
+	}
+}
+
+func TestPacer(t *testing.T) {
+	c := &pacer{rate: 10000}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := c.wait(context.Background(), 1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//第一次不等待，之后每次等待100ms
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond || elapsed > time.Second {
+		t.Fatalf("3 sends of 1000 bytes at 10000B/s took %v", elapsed)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.wait(ctx, 1000); err != context.Canceled {
+		t.Fatalf("wait after cancel = %v", err)
+	}
+}
+
+func TestServerHandoffOnce(t *testing.T) {
+	//新节点处理得较慢，交接期间自动迁移有足够的时间启动
+	var mu sync.Mutex
+	received := make(map[string]int)
+	newNode := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		for _, entry := range readBulk(t, r) {
+			received[entry.Key]++
+		}
+	}))
+	defer newNode.Close()
+	g := NewGroup("handoff-once", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}))
+	p := NewHTTPPoolOpts("http://a", &HTTPPoolOptions{Rebalance: &RebalanceOptions{Batch: 64, Delay: time.Millisecond}})
+	p.Set(p.self, newNode.URL)
+	g.RegisterPeers(p)
+	var mine []string
+	for i := 0; len(mine) < 20; i++ {
+		if key := fmt.Sprintf("key%d", i); p.owner(key) == p.self {
+			mine = append(mine, key)
+			g.store(key, &ByteView{b: []byte("v-" + key), version: g.nextVersion()})
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	s := NewServer(p, &ServerOptions{Handoff: true})
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	for _, key := range mine {
+		if received[key] != 1 {
+			t.Fatalf("%s was pushed %d times", key, received[key])
+		}
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	g := NewGroup("drain", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		if key == "slow" {
+			close(started)
+			<-release
+		}
+		return []byte("v-" + key), nil
+	}))
+	//退出时接收缓存的节点
+	var mu sync.Mutex
+	var handedOff []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, entry := range readBulk(t, r) {
+			mu.Lock()
+			handedOff = append(handedOff, entry.Key)
+			mu.Unlock()
+		}
+	}))
+	defer other.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//MaxHops为1，收到的节点请求都在本地加载
+	pool := NewHTTPPoolOpts("http://"+l.Addr().String(), &HTTPPoolOptions{MaxHops: 1})
+	pool.Set(pool.self, other.URL)
+	g.RegisterPeers(pool)
+	for i := 0; i < 20; i++ {
+		g.getLocal(fmt.Sprintf("key%d", i))
+	}
+	var left int32
+	s := NewServer(pool, &ServerOptions{Handoff: true})
+	s.OnLeave(func(ctx context.Context) error {
+		atomic.AddInt32(&left, 1)
+		return nil
+	})
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+
+	client := &httpGetter{baseURL: pool.self + defaultBasePath, client: http.DefaultClient}
+	slow := make(chan error, 1)
+	go func() {
+		res := &pb.Response{}
+		err := client.Get(&pb.Request{Group: "drain", Key: "slow"}, res)
+		if err == nil && string(res.Value) != "v-slow" {
+			err = fmt.Errorf("got %q", res.Value)
+		}
+		slow <- err
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(context.Background()) }()
+	for !s.Draining() {
+		time.Sleep(time.Millisecond)
+	}
+	//开始退出后新的请求返回UNAVAILABLE，正在进行的加载完成前不会退出
+	if err := client.Get(&pb.Request{Group: "drain", Key: "key1"}, &pb.Response{}); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("request while draining: %v", err)
+	}
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned %v before the in-flight load finished", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if err := <-slow; err != nil {
+		t.Fatalf("in-flight request: %v", err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := <-served; err != http.ErrServerClosed {
+		t.Fatalf("Serve returned %v", err)
+	}
+	if atomic.LoadInt32(&left) != 1 {
+		t.Fatal("OnLeave was not called")
+	}
+	//所有缓存都交给了剩下的节点，包括退出过程中加载的key
+	mu.Lock()
+	defer mu.Unlock()
+	if len(handedOff) != 21 {
+		t.Fatalf("handed off %d keys, want 21", len(handedOff))
+	}
+	if entries := g.mainCache.entries(0); len(entries) != 0 {
+		t.Fatalf("%d keys left after handoff", len(entries))
+	}
+}
+
+func TestGroupReplication(t *testing.T) {
+	//副本节点：记录owner推送的值，只读缓存的请求返回记录的值，没有时返回UNAVAILABLE
+	type replica struct {
+		srv  *httptest.Server
+		mu   sync.Mutex
+		vals map[string]string
+	}
+	newReplica := func() *replica {
+		r := &replica{vals: make(map[string]string)}
+		r.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if req.Method == http.MethodPost {
+				for _, entry := range readBulk(t, req) {
+					r.vals[entry.Key] = string(entry.Value.Value)
+				}
+				return
+			}
+			if req.Header.Get(cachedOnlyHeader) == "" {
+				t.Errorf("replica read without %s", cachedOnlyHeader)
+			}
+			key := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+			v, ok := r.vals[key]
+			if !ok {
+				writeError(w, ErrUnavailable)
+				return
+			}
+			body, _ := proto.Marshal(&pb.Response{Value: []byte(v)})
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(body)
+		}))
+		t.Cleanup(r.srv.Close)
+		return r
+	}
+	r1, r2 := newReplica(), newReplica()
+	get := func(r *replica, key string) (string, bool) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		v, ok := r.vals[key]
+		return v, ok
+	}
+
+	//owner加载后推送给其余两个副本
+	var loads int32
+	g := NewGroup("replicated", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		return []byte("v-" + key), nil
+	}))
+	g.SetReplication(3)
+	owner := NewHTTPPool("http://owner")
+	owner.Set(owner.self, r1.srv.URL, r2.srv.URL)
+	g.RegisterPeers(owner)
+	var owned []string
+	for i := 0; len(owned) < 5; i++ {
+		if key := fmt.Sprintf("key%d", i); owner.owner(key) == owner.self {
+			owned = append(owned, key)
+			g.Get(key)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for _, key := range owned {
+		for {
+			v1, ok1 := get(r1, key)
+			v2, ok2 := get(r2, key)
+			if ok1 && ok2 {
+				if v1 != "v-"+key || v2 != "v-"+key {
+					t.Fatalf("replicas of %s got %q and %q", key, v1, v2)
+				}
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s was not replicated", key)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	//只读缓存的请求不会触发加载
+	cachedOnlyGet := func(key string) int {
+		req := httptest.NewRequest(http.MethodGet, defaultBasePath+"replicated/"+key, nil)
+		req.Header.Set(cachedOnlyHeader, "1")
+		rec := httptest.NewRecorder()
+		owner.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	before := atomic.LoadInt32(&loads)
+	if code := cachedOnlyGet(owned[0]); code != http.StatusOK {
+		t.Fatalf("cached-only hit: %d", code)
+	}
+	if code := cachedOnlyGet("missing"); code != http.StatusServiceUnavailable || atomic.LoadInt32(&loads) != before {
+		t.Fatalf("cached-only miss: %d, loads %d -> %d", code, before, atomic.LoadInt32(&loads))
+	}
+
+	//owner不可达时从副本读取，副本都没有时才回源
+	reader := NewGroup("replicated-read", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		return []byte("origin-" + key), nil
+	}))
+	reader.SetReplication(3)
+	dead := "http://127.0.0.1:1"
+	p := NewHTTPPool("http://reader")
+	p.Set(dead, r1.srv.URL, r2.srv.URL)
+	reader.RegisterPeers(p)
+	var orphaned []string
+	for i := 0; len(orphaned) < 2; i++ {
+		if key := fmt.Sprintf("orphan%d", i); p.owner(key) == dead {
+			orphaned = append(orphaned, key)
+		}
+	}
+	//只有第二个副本上有第一个key
+	r2.mu.Lock()
+	r2.vals[orphaned[0]] = "replica-" + orphaned[0]
+	r2.mu.Unlock()
+	before = atomic.LoadInt32(&loads)
+	if v, err := reader.Get(orphaned[0]); err != nil || v.String() != "replica-"+orphaned[0] {
+		t.Fatalf("Get(%s) = %q, %v", orphaned[0], v, err)
+	}
+	if atomic.LoadInt32(&loads) != before {
+		t.Fatal("read from a replica should not hit the origin")
+	}
+	if v, err := reader.Get(orphaned[1]); err != nil || v.String() != "origin-"+orphaned[1] {
+		t.Fatalf("Get(%s) = %q, %v", orphaned[1], v, err)
+	}
+	if atomic.LoadInt32(&loads) != before+1 {
+		t.Fatal("a key missing on every replica should be loaded from the origin")
+	}
+}
+
+func TestReplicationQueue(t *testing.T) {
+	//副本一直不应答，推送只能等到超时
+	var received int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&received, 1)
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer slow.Close()
+	p := NewHTTPPoolOpts("http://owner", &HTTPPoolOptions{ReplicationQueue: 1, ReplicationTimeout: 100 * time.Millisecond})
+	p.Set(p.self, slow.URL)
+	for i, pushed := 0, 0; pushed < 20; i++ {
+		if key := fmt.Sprintf("key%d", i); p.owner(key) == p.self {
+			p.Replicate("queued", key, ByteView{b: []byte("v")}, 2)
+			pushed++
+		}
+	}
+
+	//推送中的值超时前无法排空
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.drainReplication(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("draining blocked pushes: %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.drainReplication(ctx); err != nil {
+		t.Fatalf("draining after the push timeout: %v", err)
+	}
+	//最多replicationWorkers个正在推送，加上队列中的一个，其余的被丢弃
+	n := atomic.LoadInt32(&received)
+	if n == 0 || n > replicationWorkers+1 {
+		t.Fatalf("replica received %d pushes", n)
+	}
+	//队列清空后推送协程退出，关闭后不再接受新的推送
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		p.pushes.mu.Lock()
+		workers := p.pushes.workers
+		p.pushes.mu.Unlock()
+		if workers == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d replication workers still running", workers)
+		}
+	}
+	p.closeReplication()
+	p.Replicate("queued", "key0", ByteView{b: []byte("v")}, 2)
+	if err := p.drainReplication(ctx); err != nil || atomic.LoadInt32(&received) != n {
+		t.Fatalf("push after close: %v, received %d", err, atomic.LoadInt32(&received))
+	}
+}
+
+func TestLatencyTracker(t *testing.T) {
+	l := &latencyTracker{}
+	for i := 1; i < minLatencySamples; i++ {
+		l.observe(time.Duration(i) * time.Millisecond)
+	}
+	if _, ok := l.percentile(0.95); ok {
+		t.Fatal("percentile with too few samples")
+	}
+	for i := minLatencySamples; i <= 100; i++ {
+		l.observe(time.Duration(i) * time.Millisecond)
+	}
+	if p95, ok := l.percentile(0.95); !ok || p95 != 96*time.Millisecond {
+		t.Fatalf("p95 = %v, %v", p95, ok)
+	}
+	//只保留最近的样本
+	for i := 0; i < latencyWindow; i++ {
+		l.observe(time.Second)
+	}
+	if p50, _ := l.percentile(0.5); p50 != time.Second {
+		t.Fatalf("p50 = %v after the window filled", p50)
+	}
+
+	g := &Group{replication: 2}
+	g.SetHedging(&HedgeOptions{})
+	getter := &httpGetter{latency: &latencyTracker{}}
+	if _, ok := g.hedgeDelay(getter); ok {
+		t.Fatal("hedged without latency samples")
+	}
+	for i := 0; i < minLatencySamples; i++ {
+		getter.latency.observe(100 * time.Microsecond)
+	}
+	if delay, ok := g.hedgeDelay(getter); !ok || delay != defaultHedgeMinDelay {
+		t.Fatalf("hedge delay = %v, %v, want the minimum", delay, ok)
+	}
+	g.replication = 1
+	if _, ok := g.hedgeDelay(getter); ok {
+		t.Fatal("hedged without replicas")
+	}
+}
+
+func TestGroupHedgedRead(t *testing.T) {
+	//owner很慢，记录请求是否被取消
+	var ownerDelay int64 = int64(time.Second)
+	canceled := make(chan struct{}, 10)
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Duration(atomic.LoadInt64(&ownerDelay))):
+		case <-r.Context().Done():
+			canceled <- struct{}{}
+			return
+		}
+		body, _ := proto.Marshal(&pb.Response{Value: []byte("owner")})
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(body)
+	}))
+	defer owner.Close()
+	var replicaHas int32 = 1
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(cachedOnlyHeader) == "" || atomic.LoadInt32(&replicaHas) == 0 {
+			writeError(w, ErrUnavailable)
+			return
+		}
+		body, _ := proto.Marshal(&pb.Response{Value: []byte("replica")})
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(body)
+	}))
+	defer replica.Close()
+
+	g := NewGroup("hedged", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("origin"), nil
+	}))
+	g.SetReplication(2)
+	g.SetHedging(&HedgeOptions{Delay: 20 * time.Millisecond})
+	p := NewHTTPPool("http://requester")
+	p.Set(owner.URL, replica.URL)
+	g.RegisterPeers(p)
+	var keys []string
+	for i := 0; len(keys) < 2; i++ {
+		if key := fmt.Sprintf("key%d", i); p.owner(key) == owner.URL {
+			keys = append(keys, key)
+		}
+	}
+
+	//owner超过等待时间没有响应，使用副本的结果并取消发给owner的请求
+	start := time.Now()
+	if v, err := g.Get(keys[0]); err != nil || v.String() != "replica" {
+		t.Fatalf("hedged Get = %q, %v", v, err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("hedged Get took %v", elapsed)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the request to the owner was not canceled")
+	}
+
+	//副本没有缓存时继续等待owner
+	atomic.StoreInt32(&replicaHas, 0)
+	atomic.StoreInt64(&ownerDelay, int64(100*time.Millisecond))
+	if v, err := g.Get(keys[1]); err != nil || v.String() != "owner" {
+		t.Fatalf("Get with a cold replica = %q, %v", v, err)
+	}
+	if _, ok := p.PeerLatency(owner.URL, 0.5); ok {
+		t.Fatal("one sample should not be enough for a percentile")
+	}
+}
+
+func TestHTTPPoolWrites(t *testing.T) {
+	//记录收到的写入和失效
+	type write struct {
+		method, key, value, hops string
+	}
+	var mu sync.Mutex
+	var writes []write
+	recorder := func() *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			req := &pb.SetRequest{}
+			proto.Unmarshal(body, req)
+			mu.Lock()
+			writes = append(writes, write{r.Method, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:], string(req.GetValue().GetValue()), r.Header.Get(hopsHeader)})
+			mu.Unlock()
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	takeWrites := func() []write {
+		mu.Lock()
+		defer mu.Unlock()
+		w := writes
+		writes = nil
+		return w
+	}
+
+	//owner是其他节点：写入和失效发给owner，本节点hotCache中的值删除
+	owner := recorder()
+	g := NewGroup("writes", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("origin"), nil
+	}))
+	p := NewHTTPPool("http://requester")
+	p.Set(owner.URL)
+	g.RegisterPeers(p)
+	g.hotCache.add("a", ByteView{b: []byte("stale")})
+	if err := g.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Invalidate("a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := takeWrites(); !reflect.DeepEqual(got, []write{{"PUT", "a", "1", "1"}, {"DELETE", "a", "", "1"}}) {
+		t.Fatalf("owner received %+v", got)
+	}
+	if _, ok := g.hotCache.get("a"); ok {
+		t.Fatal("Set should drop the local hot copy")
+	}
+
+	//本节点是owner：收到的写入和失效修改本地缓存并同步给副本，达到最大转发次数时不再同步
+	replica := recorder()
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	og := NewGroup("writes-owner", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		started <- struct{}{}
+		<-release
+		return []byte("loaded"), nil
+	}))
+	og.SetReplication(2)
+	o := NewHTTPPoolOpts("http://o", &HTTPPoolOptions{AllowUnauthenticatedWrites: true})
+	o.Set(o.self, replica.URL)
+	og.RegisterPeers(o)
+	var key string
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprintf("key%d", i); o.owner(k) == o.self {
+			key = k
+		}
+	}
+	serve := func(method, value, hops string) {
+		t.Helper()
+		var body io.Reader
+		if value != "" {
+			data, _ := proto.Marshal(&pb.SetRequest{Value: &pb.Response{Value: []byte(value)}})
+			body = bytes.NewReader(data)
+		}
+		req := httptest.NewRequest(method, defaultBasePath+"writes-owner/"+key, body)
+		req.Header.Set(hopsHeader, hops)
+		rec := httptest.NewRecorder()
+		o.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", method, rec.Code, rec.Body)
+		}
+	}
+	serve(http.MethodPut, "2", "1")
+	if v, ok := og.mainCache.get(key); !ok || v.String() != "2" {
+		t.Fatalf("owner cache after PUT: %q, %v", v, ok)
+	}
+	serve(http.MethodPut, "3", "2")
+	serve(http.MethodDelete, "", "1")
+	if _, ok := og.mainCache.get(key); ok {
+		t.Fatal("owner cache after DELETE still has the key")
+	}
+	if got := takeWrites(); !reflect.DeepEqual(got, []write{{"PUT", key, "2", "2"}, {"DELETE", key, "", "2"}}) {
+		t.Fatalf("replica received %+v", got)
+	}
+	//未配置密钥时默认拒绝写入和失效
+	closed := NewHTTPPool("http://o")
+	closed.Set(closed.self, replica.URL)
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		rec := httptest.NewRecorder()
+		closed.ServeHTTP(rec, httptest.NewRequest(method, defaultBasePath+"writes-owner/"+key, nil))
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("unauthenticated %s: %d", method, rec.Code)
+		}
+	}
+	//拒绝带有类型化的错误码，请求方可以识别
+	closedSrv := httptest.NewServer(closed)
+	defer closedSrv.Close()
+	cg := NewGroup("writes-closed", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	cp := NewHTTPPool("http://requester")
+	cp.Set(closedSrv.URL)
+	cg.RegisterPeers(cp)
+	if err := cg.Set("a", []byte("1")); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("Set against a pool without Secrets err = %v", err)
+	}
+	if err := cg.Invalidate("a"); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("Invalidate against a pool without Secrets err = %v", err)
+	}
+
+	//其他节点发来的失效取消owner正在进行的加载的租约
+	done := make(chan ByteView, 1)
+	go func() {
+		v, _ := og.Get(key)
+		done <- v
+	}()
+	<-started
+	serve(http.MethodDelete, "", "2")
+	close(release)
+	if v := <-done; v.String() != "loaded" {
+		t.Fatalf("in-flight Get = %q", v)
+	}
+	if _, ok := og.mainCache.get(key); ok {
+		t.Fatal("a load that raced with a remote invalidation was cached")
+	}
+}
+
+func TestHTTPPoolCompareAndSet(t *testing.T) {
+	//owner是其他节点：期望的版本随请求发给owner，owner的答复决定结果
+	var current uint64 = 7
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := &pb.SetRequest{}
+		if err := proto.Unmarshal(body, req); err != nil || r.Method != http.MethodPut {
+			writeError(w, ErrBadRequest)
+			return
+		}
+		if req.Compare && req.Version != current {
+			writeError(w, fmt.Errorf("at %d: %w", current, ErrConflict))
+			return
+		}
+		current++
+		data, _ := proto.Marshal(&pb.Response{Version: current})
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(data)
+	}))
+	defer owner.Close()
+	g := NewGroup("cas-requester", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	p := NewHTTPPool("http://requester")
+	p.Set(owner.URL)
+	g.RegisterPeers(p)
+	if version, err := g.CompareAndSet("a", []byte("1"), 7); err != nil || version != 8 {
+		t.Fatalf("CompareAndSet = %d, %v", version, err)
+	}
+	g.hotCache.add("a", ByteView{b: []byte("1"), version: 8})
+	if _, err := g.CompareAndSet("a", []byte("2"), 7); !errors.Is(err, ErrConflict) {
+		t.Fatalf("stale CompareAndSet err = %v", err)
+	}
+	if _, ok := g.hotCache.get("a"); ok {
+		t.Fatal("a conflict should drop the local hot copy")
+	}
+
+	//本节点是owner：收到的CompareAndSet在本地比较版本，成功后分配新版本并同步给副本
+	var replicated []uint64
+	var mu sync.Mutex
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//加载后的复制通过批量接口推送，这里只记录写入
+		if r.Method != http.MethodPut {
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := &pb.SetRequest{}
+		proto.Unmarshal(body, req)
+		mu.Lock()
+		replicated = append(replicated, req.GetValue().GetVersion())
+		mu.Unlock()
+	}))
+	defer replica.Close()
+	og := NewGroup("cas-owner", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	og.SetReplication(2)
+	o := NewHTTPPoolOpts("http://o", &HTTPPoolOptions{AllowUnauthenticatedWrites: true})
+	o.Set(o.self, replica.URL)
+	og.RegisterPeers(o)
+	var key string
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprintf("key%d", i); o.owner(k) == o.self {
+			key = k
+		}
+	}
+	_, loaded, err := og.GetWithVersion(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cas := func(version uint64) (*pb.Response, int) {
+		data, _ := proto.Marshal(&pb.SetRequest{Value: &pb.Response{Value: []byte("new")}, Compare: true, Version: version})
+		req := httptest.NewRequest(http.MethodPut, defaultBasePath+"cas-owner/"+key, bytes.NewReader(data))
+		req.Header.Set(hopsHeader, "1")
+		rec := httptest.NewRecorder()
+		o.ServeHTTP(rec, req)
+		res := &pb.Response{}
+		proto.Unmarshal(rec.Body.Bytes(), res)
+		return res, rec.Code
+	}
+	res, code := cas(loaded)
+	if code != http.StatusOK || res.Version <= loaded {
+		t.Fatalf("CompareAndSet on the owner: %d, version %d", code, res.Version)
+	}
+	if v, _ := og.mainCache.get(key); v.String() != "new" || v.version != res.Version {
+		t.Fatalf("owner cache: %q at %d", v, v.version)
+	}
+	if res, code := cas(loaded); code != http.StatusConflict || res.Code != pb.Code_CONFLICT {
+		t.Fatalf("stale CompareAndSet on the owner: %d %v", code, res.Code)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(replicated) != 1 || replicated[0] != res.Version {
+		t.Fatalf("replica received versions %v, want [%d]", replicated, res.Version)
+	}
+}
+
+func TestPutBufferCap(t *testing.T) {
+	large := bytes.NewBuffer(make([]byte, 0, maxPooledBuffer+1))
+	putBuffer(large)
+	for i := 0; i < 10; i++ {
+		if buf := bufferPool.Get().(*bytes.Buffer); buf == large {
+			t.Fatal("a buffer above the cap went back into the pool")
+		}
+	}
+}
+
+func TestHTTPPoolBoundedLoad(t *testing.T) {
+	var mu sync.Mutex
+	asked := map[string]bool{}
+	newPeer := func() *httptest.Server {
+		var srv *httptest.Server
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			asked[srv.URL] = r.Header.Get(askingHeader) != ""
+			mu.Unlock()
+			data, _ := proto.Marshal(&pb.Response{Value: []byte("v")})
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(data)
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	a, b := newPeer(), newPeer()
+	p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{BoundedLoad: 0.25})
+	p.Set(a.URL, b.URL)
+	ring := p.peers.(*consistenthash.Map)
+	owner := ring.Get("hot")
+
+	//热点key未完成的请求超过上限后交给另一个节点，并要求对方直接处理
+	var getters []PeerGetter
+	for i := 0; i < 8; i++ {
+		peer, ok := p.PickPeer("hot")
+		if !ok {
+			t.Fatal("PickPeer failed")
+		}
+		getters = append(getters, peer)
+	}
+	if ring.Load(owner) == 8 || ring.Load(owner) > ring.MaxLoad(owner) {
+		t.Fatalf("owner load %d, max %d", ring.Load(owner), ring.MaxLoad(owner))
+	}
+	for _, peer := range getters {
+		if err := peer.Get(&pb.Request{Group: "bounded", Key: "hot"}, &pb.Response{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ring.Load(a.URL) != 0 || ring.Load(b.URL) != 0 {
+		t.Fatalf("loads not released: %d %d", ring.Load(a.URL), ring.Load(b.URL))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for node, ask := range asked {
+		if ask != (node != owner) {
+			t.Fatalf("node %s asked=%v, owner %s", node, ask, owner)
+		}
+	}
+	if len(asked) != 2 {
+		t.Fatalf("requests reached %d nodes, want 2", len(asked))
+	}
+}
+
+func TestHTTPPoolReadReplicaSync(t *testing.T) {
+	var mu sync.Mutex
+	var writes []string
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			mu.Lock()
+			writes = append(writes, r.Method)
+			mu.Unlock()
+			return
+		}
+		data, _ := proto.Marshal(&pb.Response{Value: []byte("from-owner"), Version: 42})
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(data)
+	}))
+	defer owner.Close()
+	var origin int32
+	g := NewGroup("read-replica", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt32(&origin, 1)
+		return []byte("from-origin"), nil
+	}))
+	p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{ReadReplicas: 2})
+	p.SetPeers(Peer{Addr: "http://self", Zone: "az1"}, Peer{Addr: owner.URL, Zone: "az2"})
+	g.RegisterPeers(p)
+	keyOwnedBy := func(node string) string {
+		for i := 0; ; i++ {
+			if k := fmt.Sprintf("key%d", i); p.owner(k) == node {
+				return k
+			}
+		}
+	}
+
+	//读副本未命中时从owner获取，值和版本与owner一致，并保存在本地
+	key := keyOwnedBy(owner.URL)
+	v, version, err := g.GetWithVersion(key)
+	if err != nil || v.String() != "from-owner" || version != 42 {
+		t.Fatalf("GetWithVersion on a read replica = %q, %d, %v", v, version, err)
+	}
+	if cached, ok := g.mainCache.get(key); !ok || cached.version != 42 {
+		t.Fatal("a read replica should keep the owner's copy")
+	}
+	if n := atomic.LoadInt32(&origin); n != 0 {
+		t.Fatalf("read replica loaded from origin %d times", n)
+	}
+
+	//本节点是owner时，写入和失效同步给读副本
+	key = keyOwnedBy("http://self")
+	if err := g.Set(key, []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Invalidate(key); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(writes, []string{http.MethodPut, http.MethodDelete}) {
+		t.Fatalf("read replica received %v", writes)
+	}
+}
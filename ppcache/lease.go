@@ -0,0 +1,239 @@
+// Package ppcache
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// memcache风格的租约，避免写入和失效与正在进行的加载竞争时，旧值覆盖新的写入或失效
+package ppcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "ppcache/ppcachepb"
+	"sync"
+	"time"
+)
+
+//未命中时为key发放租约，写入和失效会取消所有未完成的租约，
+//加载完成后只有租约仍然有效时才把值写入缓存
+type leases struct {
+	mu     sync.Mutex
+	next   uint64            //下一个租约的编号，从1开始
+	tokens map[string]uint64 //key当前有效的租约
+}
+
+//发放租约，同一个key之前的租约失效
+func (l *leases) acquire(key string) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.tokens == nil {
+		l.tokens = make(map[string]uint64)
+	}
+	l.next++
+	l.tokens[key] = l.next
+	return l.next
+}
+
+//租约仍然有效时在持有锁的情况下执行fill并收回租约，返回是否执行了fill
+func (l *leases) fill(key string, token uint64, fill func()) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.tokens[key] != token {
+		return false
+	}
+	delete(l.tokens, key)
+	fill()
+	return true
+}
+
+//加载失败时收回租约
+func (l *leases) cancel(key string, token uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.tokens[key] == token {
+		delete(l.tokens, key)
+	}
+}
+
+//取消key的所有租约，并在持有锁的情况下执行update，保证之后不会再有旧的加载写入缓存
+func (l *leases) invalidate(key string, update func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.tokens, key)
+	update()
+}
+
+// PeerWriter 支持写入和失效的PeerGetter，写入和失效发往key的owner
+type PeerWriter interface {
+	// Set 写入key，out中返回owner保存的值的版本等元数据，不包含值本身
+	Set(ctx context.Context, in *pb.Request, set *pb.SetRequest, out *pb.Response) error
+	// Invalidate 删除key的缓存
+	Invalidate(ctx context.Context, in *pb.Request) error
+}
+
+// OwnerPicker 可以区分owner和读副本的PeerPicker，写入和失效使用PickOwner选择节点
+type OwnerPicker interface {
+	PickOwner(key string) (peer PeerGetter, ok bool)
+}
+
+//写入和失效发往的节点，本节点是owner时返回false
+func (g *Group) pickOwner(key string) (PeerGetter, bool) {
+	if g.peers == nil {
+		return nil, false
+	}
+	if picker, ok := g.peers.(OwnerPicker); ok {
+		return picker.PickOwner(key)
+	}
+	return g.peers.PickPeer(key)
+}
+
+// Set 写入key的值，取消正在进行的加载的租约，避免加载到的旧值覆盖这次写入
+// owner是其他节点时发给owner写入，owner再同步给副本；其他节点hotCache中的旧值在淘汰或过期前仍可能被读到
+func (g *Group) Set(key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key is require: %w", ErrBadRequest)
+	}
+	_, err := g.set(context.Background(), key, g.newView(value), nil)
+	return err
+}
+
+// Invalidate 删除key的缓存，并取消正在进行的加载的租约，之后的读取会重新加载
+// 本节点的缓存总是删除；owner是其他节点时同时通知owner，owner再通知副本
+func (g *Group) Invalidate(key string) error {
+	if key == "" {
+		return fmt.Errorf("key is require: %w", ErrBadRequest)
+	}
+	return g.invalidate(context.Background(), key)
+}
+
+//本节点写入的值
+func (g *Group) newView(value []byte) ByteView {
+	view := ByteView{b: cloneBytes(value), created: time.Now()}
+	if g.ttl > 0 {
+		view.expire = view.created.Add(g.ttl)
+	}
+	return view
+}
+
+//写入本节点或owner，本节点是owner时分配新的版本并同步给副本，返回写入的版本
+//expect不为nil时只有key当前的版本等于*expect才写入
+func (g *Group) set(ctx context.Context, key string, view ByteView, expect *uint64) (uint64, error) {
+	if peer, ok := g.pickOwner(key); ok {
+		writer, ok := peer.(PeerWriter)
+		if !ok {
+			return 0, fmt.Errorf("peer does not support writes: %w", ErrUnavailable)
+		}
+		req := &pb.SetRequest{Value: &pb.Response{}}
+		view.toResponse(req.Value)
+		if expect != nil {
+			req.Compare, req.Version = true, *expect
+		}
+		out := &pb.Response{}
+		err := writer.Set(ctx, &pb.Request{Group: g.name, Key: key}, req, out)
+		//写入成功或版本冲突时，本节点hotCache中的旧值都不再有效
+		if err == nil || errors.Is(err, ErrConflict) {
+			g.leases.invalidate(key, func() { g.hotCache.remove(key) })
+		}
+		if err != nil {
+			return 0, err
+		}
+		return out.Version, nil
+	}
+	view.version = g.nextVersion()
+	if err := g.storeIf(key, &view, expect); err != nil {
+		return 0, err
+	}
+	return view.version, g.syncReplicas(ctx, key, &view)
+}
+
+//删除本节点的缓存，owner是其他节点时通知owner，本节点是owner时通知副本
+func (g *Group) invalidate(ctx context.Context, key string) error {
+	g.store(key, nil)
+	if peer, ok := g.pickOwner(key); ok {
+		writer, ok := peer.(PeerWriter)
+		if !ok {
+			return fmt.Errorf("peer does not support invalidation: %w", ErrUnavailable)
+		}
+		return writer.Invalidate(ctx, &pb.Request{Group: g.name, Key: key})
+	}
+	return g.syncReplicas(ctx, key, nil)
+}
+
+//收到其他节点的写入或失效，view为nil表示失效；只修改本节点，不再转发给owner
+//本节点是owner时为写入分配新的版本，forward为true时再同步给副本；副本保留owner分配的版本
+//成员列表不一致时发送方可能把本节点当成副本，写入没有版本时同样分配新的版本，不保存版本为0的值
+func (g *Group) applyRemote(ctx context.Context, key string, view *ByteView, expect *uint64, forward bool) (uint64, error) {
+	_, remote := g.pickOwner(key)
+	if view != nil && (!remote || view.version == 0) {
+		view.version = g.nextVersion()
+	}
+	if err := g.storeIf(key, view, expect); err != nil {
+		return 0, err
+	}
+	var version uint64
+	if view != nil {
+		version = view.version
+	}
+	if remote || !forward {
+		return version, nil
+	}
+	return version, g.syncReplicas(ctx, key, view)
+}
+
+//取消租约并修改本节点的缓存，view为nil时删除
+func (g *Group) store(key string, view *ByteView) {
+	g.storeIf(key, view, nil)
+}
+
+//与store相同，expect不为nil时只有key当前的版本等于*expect才修改，key不在缓存中时版本为0
+//比较和修改在租约的锁内完成，不会与其他写入或加载交错
+func (g *Group) storeIf(key string, view *ByteView, expect *uint64) (err error) {
+	g.leases.invalidate(key, func() {
+		if expect != nil {
+			var current uint64
+			if v, ok := g.mainCache.get(key); ok {
+				current = v.version
+			}
+			if current != *expect {
+				err = fmt.Errorf("%s is at version %d, not %d: %w", key, current, *expect, ErrConflict)
+				return
+			}
+		}
+		if view == nil {
+			g.mainCache.remove(key)
+		} else {
+			g.observeVersion(view.version)
+			g.mainCache.add(key, *view)
+		}
+		g.hotCache.remove(key)
+	})
+	return err
+}
+
+//owner把写入或失效同步给副本，返回第一个错误
+func (g *Group) syncReplicas(ctx context.Context, key string, view *ByteView) error {
+	//副本数由节点选择算法决定，配置了读副本时即使复制因子为1也需要同步
+	r, ok := g.peers.(PeerReplicator)
+	if !ok {
+		return nil
+	}
+	var firstErr error
+	for _, peer := range r.PickReplicas(key, g.replication) {
+		writer, ok := peer.(PeerWriter)
+		if !ok {
+			continue
+		}
+		in := &pb.Request{Group: g.name, Key: key}
+		var err error
+		if view == nil {
+			err = writer.Invalidate(ctx, in)
+		} else {
+			res := &pb.Response{}
+			view.toResponse(res)
+			err = writer.Set(ctx, in, &pb.SetRequest{Value: res}, &pb.Response{})
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("updating replica: %v", err)
+		}
+	}
+	return firstErr
+}
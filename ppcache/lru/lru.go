@@ -50,24 +50,35 @@ func (c *Cache) Get(key string) (value Value, ok bool) {
 }
 
 // RemoveOldest 缓存淘汰，删除最近最少访问的节点队首
-func (c Cache) RemoveOldest() {
+func (c *Cache) RemoveOldest() {
 	ele := c.list.Back()
 	if ele != nil {
-		c.list.Remove(ele)
-		//类型转换
-		kv := ele.Value.(*entry)
-		//从字典中删除c.cache节点的映射关系
-		delete(c.cache, kv.key)
-		//更新所用内存大小
-		c.nBytes -= int64(len(kv.key)) + kv.value.Length()
-		//调用回调函数
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
-		}
+		c.removeElement(ele)
+	}
+}
+
+// Remove 删除指定的key
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	c.list.Remove(ele)
+	//类型转换
+	kv := ele.Value.(*entry)
+	//从字典中删除c.cache节点的映射关系
+	delete(c.cache, kv.key)
+	//更新所用内存大小
+	c.nBytes -= int64(len(kv.key)) + kv.value.Length()
+	//调用回调函数
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
 	}
 }
 
-func (c Cache) Add(key string, value Value) {
+func (c *Cache) Add(key string, value Value) {
 	if ele, ok := c.cache[key]; ok {
 		//如果键存在，更新对应节点的值，并且将该节点移动到队尾
 		c.list.MoveToFront(ele)
@@ -90,6 +101,16 @@ func (c Cache) Add(key string, value Value) {
 	}
 }
 
+// Range 从最近访问到最久未访问依次遍历，fn返回false时停止，遍历不改变访问顺序
+func (c *Cache) Range(fn func(key string, value Value) bool) {
+	for ele := c.list.Front(); ele != nil; ele = ele.Next() {
+		kv := ele.Value.(*entry)
+		if !fn(kv.key, kv.value) {
+			return
+		}
+	}
+}
+
 // Length 实现length方法，获取添加了多少条数据 方便测试
 func (c *Cache) Length() int64 {
 	return int64(c.list.Len())
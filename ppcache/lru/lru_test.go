@@ -49,7 +49,7 @@ func TestRemoveoldest(t *testing.T) {
 
 // 测试回调函数是否能够被调用
 func TestOnEvicted(t *testing.T) {
-	keys := make([]string, 4)
+	keys := make([]string, 0)
 	callback := func(key string, value Value) {
 		keys = append(keys, key)
 	}
@@ -59,7 +59,7 @@ func TestOnEvicted(t *testing.T) {
 	lru.Add("k3", String("k3"))
 	lru.Add("k4", String("k4"))
 
-	expect := []string{"key1"}
+	expect := []string{"key1", "k2"}
 	//比较非基础类型的两个值
 	if !reflect.DeepEqual(expect, keys) {
 		t.Fatalf("Call OnEvicted failed, expect keys equals to %s +++ %s", expect, keys)
@@ -78,3 +78,42 @@ func TestAdd(t *testing.T) {
 		t.Fatal("expected 6 but got", lru.nBytes)
 	}
 }
+
+func TestRemove(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("key1", String("1234"))
+	lru.Add("key2", String("5678"))
+	lru.Remove("key1")
+	lru.Remove("unknown")
+	if _, ok := lru.Get("key1"); ok || lru.Length() != 1 {
+		t.Fatalf("Remove key1 failed")
+	}
+	if lru.nBytes != int64(len("key2")+len("5678")) {
+		t.Fatal("expected 8 but got", lru.nBytes)
+	}
+}
+
+//按最近访问的顺序遍历，返回false时停止
+func TestRange(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("key1", String("1"))
+	lru.Add("key2", String("2"))
+	lru.Add("key3", String("3"))
+	lru.Get("key1")
+	var keys []string
+	lru.Range(func(key string, value Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if !reflect.DeepEqual(keys, []string{"key1", "key3", "key2"}) {
+		t.Fatalf("Range order %v", keys)
+	}
+	keys = nil
+	lru.Range(func(key string, value Value) bool {
+		keys = append(keys, key)
+		return len(keys) < 2
+	})
+	if len(keys) != 2 {
+		t.Fatalf("Range did not stop: %v", keys)
+	}
+}
@@ -0,0 +1,120 @@
+// Package ppcache
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// 增量地修改节点列表，以及带版本的成员视图
+package ppcache
+
+import (
+	"ppcache/consistenthash"
+	"sort"
+	"time"
+)
+
+// Membership 某一次变更后的节点列表，Version在每次变更后加一
+// 同一个Membership中的内容不会再改变，Peers按地址排序，调用方不要修改
+// Fingerprint 由节点地址、权重和虚拟节点倍数计算，成员列表一致的节点上相同
+// 选择算法的映射依赖节点添加顺序时（consistenthash.Ordered，例如Jump）还包括节点的顺序
+type Membership struct {
+	Version     uint64
+	Fingerprint uint64
+	Peers       []Peer
+}
+
+// Membership 返回当前的成员视图，不需要加锁，可以在请求路径上频繁调用
+func (p *HTTPPool) Membership() Membership {
+	return *p.view.Load().(*Membership)
+}
+
+// AddPeers 添加节点，已存在的节点更新权重和故障域
+// 只修改选择算法中变化的部分，其他节点的客户端和连接保持不变
+func (p *HTTPPool) AddPeers(peers ...Peer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		p.peers = p.opts.NewPicker()
+	}
+	for _, peer := range peers {
+		p.addPeer(peer)
+	}
+	p.publish()
+}
+
+// RemovePeers 删除节点，只有属于这些节点的key会换到其他节点上
+func (p *HTTPPool) RemovePeers(addrs ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, addr := range addrs {
+		if _, ok := p.members[addr]; !ok {
+			continue
+		}
+		p.peers.Remove(addr)
+		delete(p.members, addr)
+		delete(p.httpGetter, addr)
+		p.depart(addr)
+	}
+	p.publish()
+}
+
+//将节点加入选择算法，没有客户端时创建，调用方需要持有p.mu
+func (p *HTTPPool) addPeer(peer Peer) {
+	if peer.Weight < 1 {
+		peer.Weight = 1
+	}
+	//权重不变时不重复添加，Jump等算法重新添加节点会改变其他key的分配
+	if old, ok := p.members[peer.Addr]; !ok || old.Weight != peer.Weight {
+		p.peers.AddWeighted(peer.Addr, peer.Weight)
+	}
+	p.members[peer.Addr] = peer
+	delete(p.departed, peer.Addr)
+	if _, ok := p.httpGetter[peer.Addr]; !ok {
+		p.httpGetter[peer.Addr] = &httpGetter{
+			baseURL: peer.Addr + p.basePath,
+			client:  p.client,
+			auth:    p.auth,
+			pool:    p,
+			latency: &latencyTracker{},
+		}
+	}
+}
+
+//记录离开的节点，离开后的departedGrace内仍然接受它交出的缓存，调用方需要持有p.mu
+func (p *HTTPPool) depart(addr string) {
+	now := time.Now()
+	for node, left := range p.departed {
+		if now.Sub(left) > departedGrace {
+			delete(p.departed, node)
+		}
+	}
+	p.departed[addr] = now
+}
+
+//判断addr是否是当前的节点或者刚刚离开的节点，不包括自己
+func (p *HTTPPool) knownPeer(addr string) bool {
+	if addr == "" || addr == p.self {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.members[addr]; ok {
+		return true
+	}
+	left, ok := p.departed[addr]
+	return ok && time.Since(left) <= departedGrace
+}
+
+//生成新的成员视图，调用方需要持有p.mu
+func (p *HTTPPool) publish() {
+	p.version++
+	view := &Membership{Version: p.version, Peers: make([]Peer, 0, len(p.members))}
+	for _, peer := range p.members {
+		view.Peers = append(view.Peers, peer)
+	}
+	sort.Slice(view.Peers, func(i, j int) bool { return view.Peers[i].Addr < view.Peers[j].Addr })
+	var order []string
+	if ordered, ok := p.peers.(consistenthash.Ordered); ok {
+		order = ordered.Order()
+	}
+	view.Fingerprint = ringFingerprint(p.opts.Replicas, view.Peers, order)
+	p.view.Store(view)
+	p.notifyRebalance()
+}
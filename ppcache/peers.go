@@ -3,7 +3,10 @@
 // @time      : 2022/7/31 10:29
 package ppcache
 
-import pb "ppcache/ppcachepb"
+import (
+	"context"
+	pb "ppcache/ppcachepb"
+)
 
 // PeerPicker
 // 每个节点都有自己特有的key
@@ -18,3 +21,26 @@ type PeerGetter interface {
 	//使用protobuf进行通信
 	Get(in *pb.Request, out *pb.Response) error
 }
+
+// ContextPeerGetter 支持context的PeerGetter，ctx取消时中止请求，并随请求传递转发次数等信息
+type ContextPeerGetter interface {
+	PeerGetter
+	GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error
+}
+
+// PeerReplicator 支持副本的PeerPicker，Group设置了复制因子时使用
+type PeerReplicator interface {
+	PeerPicker
+	// Replicate 在本节点加载key之后调用，本节点是owner时把值异步推送给key的其余副本
+	Replicate(group, key string, value ByteView, n int)
+	// PickReplicas 返回key除owner和本节点以外的副本节点，owner不可用时按顺序读取
+	PickReplicas(key string, n int) []PeerGetter
+}
+
+// Peer 节点的地址、权重和所在的故障域
+type Peer struct {
+	Addr   string //节点地址，例如 http://10.0.0.2:8008
+	Weight int    //权重，虚拟节点数按权重成比例增加，小于1时按1处理
+	Zone   string //可用区，选择副本时尽量分散到不同的可用区，读取时优先使用同一可用区的副本
+	Rack   string //机架，同一可用区内尽量分散到不同的机架
+}
@@ -0,0 +1,101 @@
+// Package ppcache
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// 按可用区和机架放置副本，读取时优先访问同一可用区的副本
+package ppcache
+
+import "ppcache/consistenthash"
+
+// ReplicaPeers 返回key的n个副本节点，第一个是key的owner，其余的尽量分布在不同的可用区和机架上
+// 节点没有设置可用区和机架时与环上顺时针的前n个节点相同
+func (p *HTTPPool) ReplicaPeers(key string, n int) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.replicas(p.opts.HashTag.Extract(key), n)
+}
+
+//调用方需要持有p.mu
+func (p *HTTPPool) replicas(key string, n int) []string {
+	if p.peers == nil {
+		return nil
+	}
+	labeled := false
+	for _, peer := range p.members {
+		if peer.Zone != "" || peer.Rack != "" {
+			labeled = true
+			break
+		}
+	}
+	if !labeled {
+		return p.peers.GetN(key, n)
+	}
+	preference := p.peers.GetN(key, len(p.members))
+	return consistenthash.Spread(preference, n, func(node string) consistenthash.Labels {
+		return consistenthash.Labels{Zone: p.members[node].Zone, Rack: p.members[node].Rack}
+	})
+}
+
+//当前节点所在的可用区
+func (p *HTTPPool) zone() string {
+	if p.opts.Zone != "" {
+		return p.opts.Zone
+	}
+	return p.members[p.self].Zone
+}
+
+//选择读取key的节点：默认是key的owner，配置了ReadReplicas时优先选择同一可用区的副本，调用方需要持有p.mu
+func (p *HTTPPool) pickRead(key string) string {
+	if p.peers == nil {
+		return ""
+	}
+	if _, slotted := p.peers.(*consistenthash.Slots); slotted || p.opts.ReadReplicas <= 1 {
+		return p.peers.Get(key)
+	}
+	replicas := p.replicas(key, p.opts.ReadReplicas)
+	if len(replicas) == 0 {
+		return ""
+	}
+	//自己就是副本时直接从本地读取，本地未命中时PickPeer改为访问owner
+	for _, node := range replicas {
+		if node == p.self {
+			return node
+		}
+	}
+	if zone := p.zone(); zone != "" {
+		for _, node := range replicas {
+			if p.members[node].Zone == zone {
+				return node
+			}
+		}
+	}
+	return replicas[0]
+}
+
+//副本数至少覆盖读副本，写入、失效的同步以及迁移时读副本同样算作副本
+func (p *HTTPPool) replicaCount(n int) int {
+	if p.opts.ReadReplicas > n {
+		return p.opts.ReadReplicas
+	}
+	return n
+}
+
+// ReadReplica 配置了ReadReplicas且本节点是key的读副本而不是owner时返回true
+// 这时未命中的key从owner获取后保存在本地，副本上的值和版本都与owner一致
+func (p *HTTPPool) ReadReplica(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, slotted := p.peers.(*consistenthash.Slots); slotted || p.peers == nil || p.opts.ReadReplicas <= 1 {
+		return false
+	}
+	for i, node := range p.replicas(p.opts.HashTag.Extract(key), p.opts.ReadReplicas) {
+		if node == p.self {
+			return i > 0
+		}
+	}
+	return false
+}
+
+//可以区分读副本的PeerPicker
+type readReplicaPicker interface {
+	ReadReplica(key string) bool
+}
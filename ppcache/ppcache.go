@@ -5,20 +5,30 @@
 package ppcache
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"math/rand"
 	pb "ppcache/ppcachepb"
 	"ppcache/singleflight"
 	"sync"
+	"time"
 )
 
 // Group 缓存的命名空间 负责与用户的交互，并且控制缓存值存储和获取的流程。
 type Group struct {
+	version   uint64              //本节点分配的最新版本，原子操作，放在第一个字段保证64位对齐
 	name      string              // 唯一名称
 	getter    Getter              //缓存未命中时获取诗句的回调函数
-	mainCache cache               //并发缓存实体
+	mainCache cache               //并发缓存实体，保存本节点负责的key
+	hotCache  cache               //保存从其他节点获取的热点key，减少网络请求
 	peers     PeerPicker          //节点
 	loader    *singleflight.Group //使用singleFilght 保证每个key只能获取一次
+	ttl       time.Duration       //本地加载的值的有效期，0表示永不过期
+
+	replication int           //复制因子，大于1时owner加载的值会推送给副本节点
+	hedge       *HedgeOptions //不为nil时owner响应慢时向副本发出对冲请求
+	leases      leases        //正在进行的加载持有的租约
 }
 
 // Getter 通过key获取数据
@@ -49,6 +59,7 @@ func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
 		name:      name,
 		getter:    getter,
 		mainCache: cache{cacheBytes: cacheBytes},
+		hotCache:  cache{cacheBytes: cacheBytes / 8},
 		loader:    &singleflight.Group{},
 	}
 	groups[name] = g
@@ -63,30 +74,49 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+// Get 获取key对应的值
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 获取key对应的值，需要从其他节点获取时使用ctx
+// 同一个key的并发请求只会发出一次，使用的是第一个调用方的ctx
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
 	//key为空时返回空
 	if key == "" {
-		return ByteView{}, fmt.Errorf("key is require")
+		return ByteView{}, fmt.Errorf("key is require: %w", ErrBadRequest)
 	}
 	//从mainCache中查找缓存，如果存在就返回缓存值
 	if v, ok := g.mainCache.get(key); ok {
 		log.Println("[PPCache] hit")
 		return v, nil
 	}
+	if v, ok := g.hotCache.get(key); ok {
+		log.Println("[PPCache] hot hit")
+		return v, nil
+	}
 	//不存在
-	return g.load(key)
+	return g.load(ctx, key)
 }
 
 //load 缓存不存在时调用
-func (g *Group) load(key string) (value ByteView, err error) {
+func (g *Group) load(ctx context.Context, key string) (value ByteView, err error) {
 	//无论并发多少次，每个key只能在同一时刻只能获取一次
 	viewi, err := g.loader.Do(key, func() (interface{}, error) {
 		if g.peers != nil {
 			if peer, ok := g.peers.PickPeer(key); ok {
-				if value, err = g.getFromPeer(peer, key); err == nil {
+				if value, err = g.getFromPeerHedged(ctx, peer, key); err == nil {
 					return value, nil
 				}
+				//远程节点明确返回了不存在等错误，直接交给调用方，不再从本地加载
+				if isAuthoritative(err) {
+					return nil, err
+				}
 				log.Println("[GeeCache] Failed to get from peer", err)
+				//owner不可用时先从副本读取，避免所有请求都回源
+				if value, err = g.getFromReplicas(ctx, key); err == nil {
+					return value, nil
+				}
 			}
 		}
 		return g.getLocally(key)
@@ -97,24 +127,53 @@ func (g *Group) load(key string) (value ByteView, err error) {
 	return
 }
 
+//作为key的owner读取，未命中时直接从本地加载，不再选择其他节点，用于正在迁入的哈希槽
+func (g *Group) getLocal(key string) (ByteView, error) {
+	if v, ok := g.mainCache.get(key); ok {
+		return v, nil
+	}
+	viewi, err := g.loader.Do(key, func() (interface{}, error) {
+		return g.getLocally(key)
+	})
+	if err != nil {
+		return ByteView{}, err
+	}
+	return viewi.(ByteView), nil
+}
+
 // getLocally 调用用户的回调函数获取数据源，并且将数据院添加到缓存中
+// 加载期间key被写入或失效时租约失效，加载到的值只返回给调用方，不写入缓存
 func (g *Group) getLocally(key string) (ByteView, error) {
+	lease := g.leases.acquire(key)
 	bytes, err := g.getter.Get(key)
 	if err != nil {
+		g.leases.cancel(key, lease)
 		return ByteView{}, err
 	}
-	value := ByteView{b: cloneBytes(bytes)}
-	g.populateCache(key, value)
+	value := g.newView(bytes)
+	value.version = g.nextVersion()
+	if g.populateCache(key, lease, value, &g.mainCache) {
+		g.replicate(key, value)
+	}
 	return value, nil
 }
 
-//往缓存填充key value
-func (g *Group) populateCache(key string, value ByteView) {
-	g.mainCache.add(key, value)
+//租约仍然有效时往缓存填充key value，返回是否写入
+func (g *Group) populateCache(key string, lease uint64, value ByteView, cache *cache) bool {
+	return g.leases.fill(key, lease, func() { cache.add(key, value) })
+}
+
+// SetTTL 设置本地加载的值的有效期，需要在开始提供服务之前调用
+// 值的过期时间会随响应传给其他节点，其他节点上的副本同样在这个时间过期
+func (g *Group) SetTTL(ttl time.Duration) {
+	g.ttl = ttl
 }
 
 // RegisterPeers 注册节点
 func (g *Group) RegisterPeers(peers PeerPicker) {
+	//迁移协程会在持有读锁时遍历各个group的peers
+	mu.Lock()
+	defer mu.Unlock()
 	if g.peers != nil {
 		panic("RegisterPeerPicker called more than once")
 	}
@@ -122,7 +181,7 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 }
 
 //从节点中获取缓存
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
 	//bytes, err := peer.Get(g.name, key)
 	//改为使用protobuf进行通信
 	req := &pb.Request{
@@ -130,9 +189,37 @@ func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
 		Key:   key,
 	}
 	res := &pb.Response{}
-	err := peer.Get(req, res)
+	//按一定概率放入hotCache，本节点是读副本时总是放入mainCache，决定放入时在请求之前取得租约
+	var lease uint64
+	replica := g.readReplica(key)
+	hot := replica || rand.Intn(10) == 0
+	if hot {
+		lease = g.leases.acquire(key)
+	}
+	var err error
+	if cp, ok := peer.(ContextPeerGetter); ok {
+		err = cp.GetContext(ctx, req, res)
+	} else {
+		err = peer.Get(req, res)
+	}
 	if err != nil {
+		if hot {
+			g.leases.cancel(key, lease)
+		}
 		return ByteView{}, err
 	}
-	return ByteView{b: res.Value}, nil
+	value := viewFromResponse(res)
+	//使用owner给出的过期时间
+	if replica {
+		g.populateCache(key, lease, value, &g.mainCache)
+	} else if hot {
+		g.populateCache(key, lease, value, &g.hotCache)
+	}
+	return value, nil
+}
+
+//本节点是否是key的读副本
+func (g *Group) readReplica(key string) bool {
+	r, ok := g.peers.(readReplicaPicker)
+	return ok && r.ReadReplica(key)
 }
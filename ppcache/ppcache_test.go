@@ -4,10 +4,15 @@
 package ppcache
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 //模拟耗时的数据库
@@ -171,7 +176,7 @@ func TestGroup_load(t *testing.T) {
 				getter:    tt.fields.getter,
 				mainCache: tt.fields.mainCache,
 			}
-			gotValue, err := g.load(tt.args.key)
+			gotValue, err := g.load(context.Background(), tt.args.key)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("load() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -207,7 +212,7 @@ func TestGroup_populateCache(t *testing.T) {
 				getter:    tt.fields.getter,
 				mainCache: tt.fields.mainCache,
 			}
-			g.populateCache(tt.args.key, tt.args.value)
+			g.populateCache(tt.args.key, g.leases.acquire(tt.args.key), tt.args.value, &g.mainCache)
 		})
 	}
 }
@@ -233,3 +238,159 @@ func TestNewGroup(t *testing.T) {
 		})
 	}
 }
+
+func TestGroupTTL(t *testing.T) {
+	loads := 0
+	g := NewGroup("ttl", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(key), nil
+	}))
+	g.SetTTL(20 * time.Millisecond)
+	v, err := g.Get("Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Expire().Sub(v.CreatedAt()) != 20*time.Millisecond {
+		t.Fatalf("expire %v should be 20ms after created %v", v.Expire(), v.CreatedAt())
+	}
+	if _, err := g.Get("Tom"); err != nil || loads != 1 {
+		t.Fatalf("expected cache hit before expiry, loads %d", loads)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, err := g.Get("Tom"); err != nil || loads != 2 {
+		t.Fatalf("expected reload after expiry, loads %d", loads)
+	}
+}
+
+func TestCacheDropsExpired(t *testing.T) {
+	c := cache{cacheBytes: 2 << 10}
+	c.add("live", ByteView{b: []byte("1"), expire: time.Now().Add(time.Hour)})
+	c.add("dead", ByteView{b: []byte("2"), expire: time.Now().Add(-time.Second)})
+	if _, ok := c.get("live"); !ok {
+		t.Fatal("live entry should be returned")
+	}
+	if _, ok := c.get("dead"); ok {
+		t.Fatal("expired entry should be a miss")
+	}
+	if c.lru.Length() != 1 {
+		t.Fatalf("expired entry should be removed, %d entries left", c.lru.Length())
+	}
+}
+
+//写入和失效与正在进行的加载竞争时，加载到的旧值不能写入缓存
+func TestGroupLeases(t *testing.T) {
+	var loads int32
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	g := NewGroup("leases", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		n := atomic.AddInt32(&loads, 1)
+		started <- struct{}{}
+		<-release
+		return []byte(fmt.Sprintf("%s-v%d", key, n)), nil
+	}))
+	load := func(key string) chan ByteView {
+		done := make(chan ByteView, 1)
+		go func() {
+			v, _ := g.Get(key)
+			done <- v
+		}()
+		<-started
+		return done
+	}
+
+	//加载过程中失效：调用方拿到加载的值，但不写入缓存，下次读取重新加载
+	done := load("k")
+	if err := g.Invalidate("k"); err != nil {
+		t.Fatal(err)
+	}
+	release <- struct{}{}
+	if v := <-done; v.String() != "k-v1" {
+		t.Fatalf("in-flight Get = %q", v)
+	}
+	if _, ok := g.mainCache.get("k"); ok {
+		t.Fatal("a load that raced with Invalidate was cached")
+	}
+	done = load("k")
+	release <- struct{}{}
+	if v := <-done; v.String() != "k-v2" {
+		t.Fatalf("Get after Invalidate = %q", v)
+	}
+	if v, ok := g.mainCache.get("k"); !ok || v.String() != "k-v2" {
+		t.Fatal("a load with a valid lease should be cached")
+	}
+
+	//加载过程中写入：写入的值不会被加载到的旧值覆盖
+	done = load("s")
+	if err := g.Set("s", []byte("written")); err != nil {
+		t.Fatal(err)
+	}
+	release <- struct{}{}
+	<-done
+	if v, err := g.Get("s"); err != nil || v.String() != "written" {
+		t.Fatalf("Get after Set = %q, %v", v, err)
+	}
+	if n := atomic.LoadInt32(&loads); n != 3 {
+		t.Fatalf("loads = %d, want 3", n)
+	}
+	if len(g.leases.tokens) != 0 {
+		t.Fatalf("leases left behind: %v", g.leases.tokens)
+	}
+}
+
+func TestGroupCompareAndSet(t *testing.T) {
+	g := NewGroup("cas", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	v, loaded, err := g.GetWithVersion("a")
+	if err != nil || v.String() != "a" || loaded == 0 {
+		t.Fatalf("GetWithVersion = %q, %d, %v", v, loaded, err)
+	}
+	set, err := g.CompareAndSet("a", []byte("a2"), loaded)
+	if err != nil || set <= loaded {
+		t.Fatalf("CompareAndSet = %d, %v, want a version after %d", set, err, loaded)
+	}
+	//使用过时的版本写入失败，值不变
+	if _, err := g.CompareAndSet("a", []byte("a3"), loaded); !errors.Is(err, ErrConflict) {
+		t.Fatalf("stale CompareAndSet err = %v", err)
+	}
+	if v, version, _ := g.GetWithVersion("a"); v.String() != "a2" || version != set {
+		t.Fatalf("after conflict: %q at %d", v, version)
+	}
+	//版本0表示key不在缓存中
+	if _, err := g.CompareAndSet("a", []byte("a4"), 0); !errors.Is(err, ErrConflict) {
+		t.Fatalf("CompareAndSet(0) on a cached key err = %v", err)
+	}
+	if _, err := g.CompareAndSet("b", []byte("b1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	//Set同样分配新的版本
+	if err := g.Set("a", []byte("a5")); err != nil {
+		t.Fatal(err)
+	}
+	if _, version, _ := g.GetWithVersion("a"); version <= set {
+		t.Fatalf("Set kept version %d", version)
+	}
+	if code := StatusCode(ErrConflict); code != http.StatusConflict {
+		t.Fatalf("StatusCode(ErrConflict) = %d", code)
+	}
+}
+
+func TestGroupApplyRemoteVersion(t *testing.T) {
+	g := NewGroup("apply-remote", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	//所有key的owner都是其他节点，本节点只是副本
+	p := NewHTTPPool("http://self")
+	p.Set("http://other")
+	g.RegisterPeers(p)
+	version, err := g.applyRemote(context.Background(), "a", &ByteView{b: []byte("a1"), version: 7}, nil, false)
+	if err != nil || version != 7 {
+		t.Fatalf("replica write = %d, %v, want the owner's version 7", version, err)
+	}
+	version, err = g.applyRemote(context.Background(), "b", &ByteView{b: []byte("b1")}, nil, false)
+	if err != nil || version == 0 {
+		t.Fatalf("unversioned write = %d, %v, want a new version", version, err)
+	}
+	if _, cached, _ := g.GetWithVersion("b"); cached != version {
+		t.Fatalf("cached version %d, want %d", cached, version)
+	}
+}
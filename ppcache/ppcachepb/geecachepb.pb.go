@@ -20,6 +20,55 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
+type Code int32
+
+const (
+	Code_OK                Code = 0
+	Code_NOT_FOUND         Code = 1
+	Code_TOO_MANY_REQUESTS Code = 2
+	Code_UNAVAILABLE       Code = 3
+	Code_BAD_REQUEST       Code = 4
+	Code_INTERNAL          Code = 5
+	Code_MOVED             Code = 6
+	Code_ASK               Code = 7
+	Code_CONFLICT          Code = 8
+	Code_PERMISSION_DENIED Code = 9
+)
+
+var Code_name = map[int32]string{
+	0: "OK",
+	1: "NOT_FOUND",
+	2: "TOO_MANY_REQUESTS",
+	3: "UNAVAILABLE",
+	4: "BAD_REQUEST",
+	5: "INTERNAL",
+	6: "MOVED",
+	7: "ASK",
+	8: "CONFLICT",
+	9: "PERMISSION_DENIED",
+}
+
+var Code_value = map[string]int32{
+	"OK":                0,
+	"NOT_FOUND":         1,
+	"TOO_MANY_REQUESTS": 2,
+	"UNAVAILABLE":       3,
+	"BAD_REQUEST":       4,
+	"INTERNAL":          5,
+	"MOVED":             6,
+	"ASK":               7,
+	"CONFLICT":          8,
+	"PERMISSION_DENIED": 9,
+}
+
+func (x Code) String() string {
+	return proto.EnumName(Code_name, int32(x))
+}
+
+func (Code) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_889d0a4ad37a0d42, []int{0}
+}
+
 type Request struct {
 	Group                string   `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
 	Key                  string   `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
@@ -69,6 +118,13 @@ func (m *Request) GetKey() string {
 
 type Response struct {
 	Value                []byte   `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	Code                 Code     `protobuf:"varint,2,opt,name=code,proto3,enum=geecachepb.Code" json:"code,omitempty"`
+	Message              string   `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	ExpireAt             int64    `protobuf:"varint,4,opt,name=expire_at,json=expireAt,proto3" json:"expire_at,omitempty"`
+	Version              uint64   `protobuf:"varint,5,opt,name=version,proto3" json:"version,omitempty"`
+	CreatedAt            int64    `protobuf:"varint,6,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	Flags                uint32   `protobuf:"varint,7,opt,name=flags,proto3" json:"flags,omitempty"`
+	Redirect             string   `protobuf:"bytes,8,opt,name=redirect,proto3" json:"redirect,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -106,23 +162,196 @@ func (m *Response) GetValue() []byte {
 	return nil
 }
 
+func (m *Response) GetCode() Code {
+	if m != nil {
+		return m.Code
+	}
+	return Code_OK
+}
+
+func (m *Response) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func (m *Response) GetExpireAt() int64 {
+	if m != nil {
+		return m.ExpireAt
+	}
+	return 0
+}
+
+func (m *Response) GetVersion() uint64 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *Response) GetCreatedAt() int64 {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return 0
+}
+
+func (m *Response) GetFlags() uint32 {
+	if m != nil {
+		return m.Flags
+	}
+	return 0
+}
+
+func (m *Response) GetRedirect() string {
+	if m != nil {
+		return m.Redirect
+	}
+	return ""
+}
+
+type BulkEntry struct {
+	Key                  string    `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value                *Response `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *BulkEntry) Reset()         { *m = BulkEntry{} }
+func (m *BulkEntry) String() string { return proto.CompactTextString(m) }
+func (*BulkEntry) ProtoMessage()    {}
+func (*BulkEntry) Descriptor() ([]byte, []int) {
+	return fileDescriptor_889d0a4ad37a0d42, []int{2}
+}
+
+func (m *BulkEntry) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BulkEntry.Unmarshal(m, b)
+}
+func (m *BulkEntry) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BulkEntry.Marshal(b, m, deterministic)
+}
+func (m *BulkEntry) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BulkEntry.Merge(m, src)
+}
+func (m *BulkEntry) XXX_Size() int {
+	return xxx_messageInfo_BulkEntry.Size(m)
+}
+func (m *BulkEntry) XXX_DiscardUnknown() {
+	xxx_messageInfo_BulkEntry.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BulkEntry proto.InternalMessageInfo
+
+func (m *BulkEntry) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *BulkEntry) GetValue() *Response {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+type SetRequest struct {
+	Value                *Response `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	Compare              bool      `protobuf:"varint,2,opt,name=compare,proto3" json:"compare,omitempty"`
+	Version              uint64    `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *SetRequest) Reset()         { *m = SetRequest{} }
+func (m *SetRequest) String() string { return proto.CompactTextString(m) }
+func (*SetRequest) ProtoMessage()    {}
+func (*SetRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_889d0a4ad37a0d42, []int{3}
+}
+
+func (m *SetRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SetRequest.Unmarshal(m, b)
+}
+func (m *SetRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SetRequest.Marshal(b, m, deterministic)
+}
+func (m *SetRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SetRequest.Merge(m, src)
+}
+func (m *SetRequest) XXX_Size() int {
+	return xxx_messageInfo_SetRequest.Size(m)
+}
+func (m *SetRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SetRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SetRequest proto.InternalMessageInfo
+
+func (m *SetRequest) GetValue() *Response {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+func (m *SetRequest) GetCompare() bool {
+	if m != nil {
+		return m.Compare
+	}
+	return false
+}
+
+func (m *SetRequest) GetVersion() uint64 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
 func init() {
+	proto.RegisterEnum("geecachepb.Code", Code_name, Code_value)
 	proto.RegisterType((*Request)(nil), "geecachepb.Request")
 	proto.RegisterType((*Response)(nil), "geecachepb.Response")
+	proto.RegisterType((*BulkEntry)(nil), "geecachepb.BulkEntry")
+	proto.RegisterType((*SetRequest)(nil), "geecachepb.SetRequest")
 }
 
 func init() { proto.RegisterFile("geecachepb.proto", fileDescriptor_889d0a4ad37a0d42) }
 
 var fileDescriptor_889d0a4ad37a0d42 = []byte{
-	// 148 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x12, 0x48, 0x4f, 0x4d, 0x4d,
-	0x4e, 0x4c, 0xce, 0x48, 0x2d, 0x48, 0xd2, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0xe2, 0x42, 0x88,
-	0x28, 0x19, 0x72, 0xb1, 0x07, 0xa5, 0x16, 0x96, 0xa6, 0x16, 0x97, 0x08, 0x89, 0x70, 0xb1, 0xa6,
-	0x17, 0xe5, 0x97, 0x16, 0x48, 0x30, 0x2a, 0x30, 0x6a, 0x70, 0x06, 0x41, 0x38, 0x42, 0x02, 0x5c,
-	0xcc, 0xd9, 0xa9, 0x95, 0x12, 0x4c, 0x60, 0x31, 0x10, 0x53, 0x49, 0x81, 0x8b, 0x23, 0x28, 0xb5,
-	0xb8, 0x20, 0x3f, 0xaf, 0x38, 0x15, 0xa4, 0xa7, 0x2c, 0x31, 0xa7, 0x34, 0x15, 0xac, 0x87, 0x27,
-	0x08, 0xc2, 0x31, 0xb2, 0xe3, 0xe2, 0x72, 0x07, 0x69, 0x76, 0x06, 0x59, 0x22, 0x64, 0xc0, 0xc5,
-	0xec, 0x9e, 0x5a, 0x22, 0x24, 0xac, 0x87, 0xe4, 0x10, 0xa8, 0x9d, 0x52, 0x22, 0xa8, 0x82, 0x10,
-	0x53, 0x93, 0xd8, 0xc0, 0xee, 0x34, 0x06, 0x04, 0x00, 0x00, 0xff, 0xff, 0x5c, 0xd5, 0xdd, 0x09,
-	0xbb, 0x00, 0x00, 0x00,
+	// 457 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x92, 0xd1, 0x6f, 0x93, 0x50,
+	0x14, 0xc6, 0xa5, 0xd0, 0x02, 0x67, 0x9b, 0x5e, 0x8f, 0x33, 0x21, 0x33, 0x26, 0x4d, 0xe3, 0x43,
+	0xd3, 0x87, 0x45, 0xeb, 0xbb, 0x09, 0x2d, 0x6c, 0x21, 0x6b, 0x41, 0x2f, 0x74, 0x89, 0x4f, 0x84,
+	0xd1, 0x63, 0x6d, 0xd6, 0x15, 0x84, 0xdb, 0xc5, 0xfd, 0x31, 0xfe, 0x7f, 0xfe, 0x19, 0xe6, 0x5e,
+	0xc6, 0x6c, 0x13, 0xe3, 0x1b, 0xdf, 0xc7, 0xfd, 0xee, 0x3d, 0xdf, 0x2f, 0x07, 0xd8, 0x8a, 0x28,
+	0xcf, 0xf2, 0xef, 0x54, 0xde, 0x9c, 0x97, 0x55, 0x21, 0x0a, 0x84, 0xbf, 0xce, 0xe0, 0x03, 0x98,
+	0x9c, 0x7e, 0xec, 0xa8, 0x16, 0x78, 0x0a, 0xdd, 0x55, 0x55, 0xec, 0x4a, 0x47, 0xeb, 0x6b, 0x43,
+	0x9b, 0x37, 0x02, 0x19, 0xe8, 0xb7, 0xf4, 0xe0, 0x74, 0x94, 0x27, 0x3f, 0x07, 0xbf, 0x35, 0xb0,
+	0x38, 0xd5, 0x65, 0xb1, 0xad, 0x49, 0x86, 0xee, 0xb3, 0xcd, 0x8e, 0x54, 0xe8, 0x98, 0x37, 0x02,
+	0xdf, 0x81, 0x91, 0x17, 0x4b, 0x52, 0xa9, 0xe7, 0x63, 0x76, 0xbe, 0x37, 0xc2, 0xb4, 0x58, 0x12,
+	0x57, 0x7f, 0xd1, 0x01, 0xf3, 0x8e, 0xea, 0x3a, 0x5b, 0x91, 0xa3, 0xab, 0xeb, 0x5b, 0x89, 0x6f,
+	0xc0, 0xa6, 0x9f, 0xe5, 0xba, 0xa2, 0x34, 0x13, 0x8e, 0xd1, 0xd7, 0x86, 0x3a, 0xb7, 0x1a, 0xc3,
+	0x15, 0x32, 0x76, 0x4f, 0x55, 0xbd, 0x2e, 0xb6, 0x4e, 0xb7, 0xaf, 0x0d, 0x0d, 0xde, 0x4a, 0x7c,
+	0x0b, 0x90, 0x57, 0x94, 0x09, 0x5a, 0xca, 0x5c, 0x4f, 0xe5, 0xec, 0x47, 0xc7, 0x55, 0x05, 0xbf,
+	0x6d, 0xb2, 0x55, 0xed, 0x98, 0x7d, 0x6d, 0x78, 0xc2, 0x1b, 0x81, 0x67, 0x60, 0x55, 0xb4, 0x5c,
+	0x57, 0x94, 0x0b, 0xc7, 0x52, 0x63, 0x3c, 0xe9, 0x41, 0x00, 0xf6, 0x64, 0xb7, 0xb9, 0xf5, 0xb7,
+	0xa2, 0x7a, 0x68, 0x49, 0x68, 0x4f, 0x24, 0x70, 0xd4, 0x96, 0x97, 0x3d, 0x8f, 0xc6, 0xa7, 0xfb,
+	0x3d, 0x5b, 0x42, 0x8f, 0x48, 0x06, 0x1b, 0x80, 0x98, 0x44, 0xcb, 0x7a, 0xb4, 0x8f, 0xed, 0xff,
+	0x49, 0xd9, 0x37, 0x2f, 0xee, 0xca, 0xac, 0x6a, 0xde, 0xb1, 0x78, 0x2b, 0xf7, 0x49, 0xe8, 0x07,
+	0x24, 0x46, 0xbf, 0x34, 0x30, 0x24, 0x69, 0xec, 0x41, 0x27, 0xba, 0x62, 0xcf, 0xf0, 0x04, 0xec,
+	0x30, 0x4a, 0xd2, 0x8b, 0x68, 0x11, 0x7a, 0x4c, 0xc3, 0xd7, 0xf0, 0x32, 0x89, 0xa2, 0x74, 0xee,
+	0x86, 0x5f, 0x53, 0xee, 0x7f, 0x59, 0xf8, 0x71, 0x12, 0xb3, 0x0e, 0xbe, 0x80, 0xa3, 0x45, 0xe8,
+	0x5e, 0xbb, 0xc1, 0xcc, 0x9d, 0xcc, 0x7c, 0xa6, 0x4b, 0x63, 0xe2, 0x7a, 0xed, 0x11, 0x66, 0xe0,
+	0x31, 0x58, 0x41, 0x98, 0xf8, 0x3c, 0x74, 0x67, 0xac, 0x8b, 0x36, 0x74, 0xe7, 0xd1, 0xb5, 0xef,
+	0xb1, 0x1e, 0x9a, 0xa0, 0xbb, 0xf1, 0x15, 0x33, 0xe5, 0x89, 0x69, 0x14, 0x5e, 0xcc, 0x82, 0x69,
+	0xc2, 0x2c, 0xf9, 0xd0, 0x67, 0x9f, 0xcf, 0x83, 0x38, 0x0e, 0xa2, 0x30, 0xf5, 0xfc, 0x30, 0xf0,
+	0x3d, 0x66, 0x8f, 0x3f, 0x01, 0x5c, 0xca, 0xf5, 0x9a, 0xca, 0xce, 0xf8, 0x1e, 0xf4, 0x4b, 0x12,
+	0xf8, 0xea, 0x90, 0x82, 0x22, 0x75, 0xf6, 0x4f, 0x34, 0x37, 0x3d, 0xb5, 0xc9, 0x1f, 0xff, 0x0c,
+	0x00, 0x64, 0x3e, 0xfc, 0x4d, 0xdd, 0x02, 0x00, 0x00,
 }
@@ -0,0 +1,343 @@
+// Package ppcache
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// 成员变化后把不再属于本节点的缓存推给新的owner，避免新节点冷启动和下线节点的缓存丢失
+package ppcache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"io"
+	"net/http"
+	"net/url"
+	pb "ppcache/ppcachepb"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	bulkPath = "_bulk" //批量传输的路径，/<basepath>/_bulk/<groupname>，group不能使用这个名称
+
+	defaultRebalanceRate  = 8 << 20     //默认每秒最多发送8MB
+	defaultRebalanceBatch = 1 << 20     //默认每个请求最多携带1MB
+	defaultRebalanceDelay = time.Second //默认成员变化后等待1秒再开始迁移
+	maxBulkEntry          = 64 << 20    //批量传输中单个值的上限
+	maxBulkEntries        = 1 << 16     //一次批量传输最多携带的key数
+	maxBulkBody           = 128 << 20   //一次批量传输的请求体上限
+	departedGrace         = time.Minute //节点离开后仍然接受它推送缓存的时间，覆盖下线前的交接
+)
+
+// RebalanceOptions 成员变化后迁移缓存的配置，零值字段使用默认值
+type RebalanceOptions struct {
+	Rate    int64         //每秒最多发送的字节数，限制迁移对正常请求的影响，默认8MB
+	Batch   int64         //每个请求最多携带的字节数，默认1MB
+	HotKeys int           //每个group只迁移最近访问的HotKeys个key，0表示迁移所有不再属于本节点的key
+	Delay   time.Duration //成员变化后等待的时间，期间的多次变化合并为一次迁移，默认1秒
+}
+
+//填充未设置的配置项
+func (o *RebalanceOptions) setDefaults() {
+	if o.Rate <= 0 {
+		o.Rate = defaultRebalanceRate
+	}
+	if o.Batch <= 0 {
+		o.Batch = defaultRebalanceBatch
+	}
+	//超过Batch后才发送，留出最后一个值的空间，保证请求体不超过接收方的上限
+	if o.Batch > maxBulkBody/4 {
+		o.Batch = maxBulkBody / 4
+	}
+	if o.Delay <= 0 {
+		o.Delay = defaultRebalanceDelay
+	}
+}
+
+//成员变化时通知迁移协程，调用方需要持有p.mu
+func (p *HTTPPool) notifyRebalance() {
+	if p.rebalance == nil || atomic.LoadInt32(&p.handingOff) != 0 {
+		return
+	}
+	select {
+	case p.rebalance <- struct{}{}:
+	default:
+	}
+}
+
+//开始下线时的交接，之后成员变化不再触发自动迁移，由Shutdown直接调用Rebalance
+func (p *HTTPPool) beginHandoff() {
+	atomic.StoreInt32(&p.handingOff, 1)
+}
+
+//等待成员变化，合并Delay内的多次变化后执行一次迁移
+func (p *HTTPPool) rebalanceLoop() {
+	for range p.rebalance {
+		time.Sleep(p.opts.Rebalance.Delay)
+		select {
+		case <-p.rebalance:
+		default:
+		}
+		moved, err := p.Rebalance(context.Background())
+		if err != nil {
+			p.Log("rebalance: moved %d keys: %v", moved, err)
+		} else if moved > 0 {
+			p.Log("rebalance: moved %d keys", moved)
+		}
+	}
+}
+
+// Rebalance 把本节点缓存中owner已经不是自己的key推给新的owner，推送成功的key从本地删除
+// 配置了RebalanceOptions时成员变化后会自动执行；节点下线前可以先RemovePeers(自己)再调用，把缓存交给其他节点
+// 返回推送成功的key的数量，部分节点失败时返回第一个错误
+func (p *HTTPPool) Rebalance(ctx context.Context) (int, error) {
+	//已经在进行的迁移完成后，推送成功的key已经从本地删除，不会重复推送
+	p.balancing.Lock()
+	defer p.balancing.Unlock()
+	o := RebalanceOptions{}
+	if p.opts.Rebalance != nil {
+		o = *p.opts.Rebalance
+	}
+	o.setDefaults()
+	pace := &pacer{rate: o.Rate}
+	moved := 0
+	var firstErr error
+	for _, g := range p.groups() {
+		n, err := p.rebalanceGroup(ctx, g, &o, pace)
+		moved += n
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			return moved, ctx.Err()
+		}
+	}
+	return moved, firstErr
+}
+
+//注册到本节点的group
+func (p *HTTPPool) groups() []*Group {
+	mu.RLock()
+	defer mu.RUnlock()
+	var list []*Group
+	for _, g := range groups {
+		if g.peers == PeerPicker(p) {
+			list = append(list, g)
+		}
+	}
+	return list
+}
+
+//key的owner，不考虑读副本
+func (p *HTTPPool) owner(key string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return ""
+	}
+	return p.peers.Get(p.opts.HashTag.Extract(key))
+}
+
+//等待推送到某个节点的一批key
+type bulkBatch struct {
+	keys     []string
+	versions []uint64 //推送的值的版本，与keys一一对应
+	buf      bytes.Buffer
+}
+
+//按最近访问的顺序推送一个group中需要迁移的key，每个节点的数据攒够Batch后发送一次
+func (p *HTTPPool) rebalanceGroup(ctx context.Context, g *Group, o *RebalanceOptions, pace *pacer) (int, error) {
+	batches := make(map[string]*bulkBatch)
+	moved := 0
+	var firstErr error
+	flush := func(node string, b *bulkBatch) {
+		delete(batches, node)
+		if err := pace.wait(ctx, int64(b.buf.Len())); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return
+		}
+		if err := p.sendBulk(ctx, node, g.name, b.buf.Bytes()); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("sending to %s: %v", node, err)
+			}
+			return
+		}
+		//推送后key可能已经被写入新的值，只删除版本仍然是推送时版本的key
+		for i, key := range b.keys {
+			g.storeIf(key, nil, &b.versions[i])
+		}
+		moved += len(b.keys)
+	}
+	for _, e := range g.mainCache.entries(o.HotKeys) {
+		node := p.owner(e.key)
+		//本节点仍然是key的副本或读副本时保留
+		if node == "" || node == p.self || p.isReplica(e.key, p.replicaCount(g.replication)) {
+			continue
+		}
+		b := batches[node]
+		if b == nil {
+			b = &bulkBatch{}
+			batches[node] = b
+		}
+		if err := writeBulkEntry(&b.buf, e.key, e.value); err != nil {
+			return moved, err
+		}
+		b.keys = append(b.keys, e.key)
+		b.versions = append(b.versions, e.value.version)
+		if int64(b.buf.Len()) >= o.Batch || len(b.keys) >= maxBulkEntries {
+			flush(node, b)
+		}
+	}
+	for node, b := range batches {
+		flush(node, b)
+	}
+	return moved, firstErr
+}
+
+//编码一个key，写入长度前缀和BulkEntry
+func writeBulkEntry(buf *bytes.Buffer, key string, value ByteView) error {
+	entry := &pb.BulkEntry{Key: key, Value: &pb.Response{}}
+	value.toResponse(entry.Value)
+	data, err := proto.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	var prefix [binary.MaxVarintLen64]byte
+	buf.Write(prefix[:binary.PutUvarint(prefix[:], uint64(len(data)))])
+	buf.Write(data)
+	return nil
+}
+
+//向node发送一批数据，请求体是按长度前缀依次排列的BulkEntry
+func (p *HTTPPool) sendBulk(ctx context.Context, node, group string, body []byte) error {
+	u := fmt.Sprintf("%v%v%v/%v?from=%v", node, p.basePath, bulkPath, url.QueryEscape(group), url.QueryEscape(p.self))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if p.auth != nil {
+		if err = p.auth.sign(req); err != nil {
+			return err
+		}
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode != http.StatusOK {
+		return &remoteError{code: statusCode(res.StatusCode), message: fmt.Sprintf("server return: %v", res.Status)}
+	}
+	return nil
+}
+
+//接收其他节点推送的数据，只保存owner是自己的key，已经在缓存中的key保持不变
+//owner是发送方的key同样接收：owner向副本复制的值，以及节点下线前交出、接收方还没有删除它时的key
+//推送会直接写入缓存，只接受签名有效、并且在成员列表中或者刚刚离开的节点
+func (p *HTTPPool) serveBulk(w http.ResponseWriter, r *http.Request, groupName string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if p.auth == nil {
+		writeError(w, fmt.Errorf("bulk transfers require signed requests, configure Secrets: %w", ErrPermissionDenied))
+		return
+	}
+	from := r.URL.Query().Get("from")
+	if !p.knownPeer(from) {
+		writeError(w, fmt.Errorf("bulk transfer from unknown peer %q: %w", from, ErrPermissionDenied))
+		return
+	}
+	if r.ContentLength > maxBulkBody {
+		http.Error(w, "bulk transfer too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	group := GetGroup(groupName)
+	if group == nil {
+		writeError(w, fmt.Errorf("no such group: %s: %w", groupName, ErrNotFound))
+		return
+	}
+	now := time.Now()
+	reader := bufio.NewReader(http.MaxBytesReader(w, r.Body, maxBulkBody))
+	var budget uint64 = maxBulkBody //剩余可以读取的字节数，分配内存前检查，不信任长度前缀
+	accepted := 0
+	for entries := 0; ; entries++ {
+		size, err := binary.ReadUvarint(reader)
+		if err == io.EOF {
+			break
+		}
+		if err == nil && entries >= maxBulkEntries {
+			err = fmt.Errorf("more than %d entries", maxBulkEntries)
+		}
+		if err == nil && (size > maxBulkEntry || size > budget) {
+			err = fmt.Errorf("entry of %d bytes exceeds the limit", size)
+		}
+		if err != nil {
+			writeError(w, fmt.Errorf("reading bulk entry: %v: %w", err, ErrBadRequest))
+			return
+		}
+		budget -= size
+		data := make([]byte, size)
+		if _, err = io.ReadFull(reader, data); err != nil {
+			writeError(w, fmt.Errorf("reading bulk entry: %v: %w", err, ErrBadRequest))
+			return
+		}
+		entry := &pb.BulkEntry{}
+		if err = proto.Unmarshal(data, entry); err != nil || entry.Value == nil {
+			writeError(w, fmt.Errorf("decoding bulk entry: %v: %w", err, ErrBadRequest))
+			return
+		}
+		if owner := p.owner(entry.Key); owner != p.self && (from == "" || owner != from) {
+			continue
+		}
+		value := viewFromResponse(entry.Value)
+		if value.expired(now) {
+			continue
+		}
+		//取得租约后再检查，避免与同时到达的写入和失效竞争
+		lease := group.leases.acquire(entry.Key)
+		if _, ok := group.mainCache.get(entry.Key); ok {
+			group.leases.cancel(entry.Key, lease)
+			continue
+		}
+		//保留原owner分配的版本，之后的CompareAndSet仍然可以使用
+		group.observeVersion(value.version)
+		if group.populateCache(entry.Key, lease, value, &group.mainCache) {
+			accepted++
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "%d\n", accepted)
+}
+
+//按字节数限速，每次发送前等待上一次发送按速率需要的时间
+type pacer struct {
+	rate int64     //每秒的字节数
+	next time.Time //下一次可以发送的时间
+}
+
+func (c *pacer) wait(ctx context.Context, n int64) error {
+	now := time.Now()
+	if c.next.Before(now) {
+		c.next = now
+	}
+	delay := c.next.Sub(now)
+	c.next = c.next.Add(time.Duration(n * int64(time.Second) / c.rate))
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,224 @@
+// Package ppcache
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// 把owner加载的值复制到环上后续的节点，owner不可用时从副本读取
+package ppcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const (
+	cachedOnlyHeader   = "X-Ppcache-Cached-Only" //只读取缓存，未命中时不加载
+	replicationWorkers = 4                       //推送给副本的协程数
+)
+
+// SetReplication 设置复制因子，n大于1时owner加载的值会异步推送给环上其余n-1个副本节点，
+// owner不可用时先从副本读取再回源；所有节点需要使用相同的值，需要在开始提供服务之前调用
+// 副本只接受签名的推送，所有节点需要配置相同的HTTPPoolOptions.Secrets
+func (g *Group) SetReplication(n int) {
+	g.replication = n
+}
+
+//把本节点加载的值推送给副本，是否推送由节点选择算法决定
+func (g *Group) replicate(key string, value ByteView) {
+	if g.replication <= 1 {
+		return
+	}
+	if r, ok := g.peers.(PeerReplicator); ok {
+		r.Replicate(g.name, key, value, g.replication)
+	}
+}
+
+//依次从副本节点的缓存中读取，副本不会因为这次请求回源
+func (g *Group) getFromReplicas(ctx context.Context, key string) (ByteView, error) {
+	r, ok := g.peers.(PeerReplicator)
+	if g.replication <= 1 || !ok {
+		return ByteView{}, fmt.Errorf("no replicas: %w", ErrUnavailable)
+	}
+	err := fmt.Errorf("no replicas: %w", ErrUnavailable)
+	for _, peer := range r.PickReplicas(key, g.replication) {
+		var value ByteView
+		if value, err = g.getFromPeer(withCachedOnly(ctx), peer, key); err == nil {
+			return value, nil
+		}
+	}
+	return ByteView{}, err
+}
+
+//只从本地缓存读取，未命中时返回ErrUnavailable，请求方会继续尝试其他副本
+func (g *Group) getCached(key string) (ByteView, error) {
+	if v, ok := g.mainCache.get(key); ok {
+		return v, nil
+	}
+	if v, ok := g.hotCache.get(key); ok {
+		return v, nil
+	}
+	return ByteView{}, fmt.Errorf("%s is not cached: %w", key, ErrUnavailable)
+}
+
+//请求只读取对方的缓存，保存在context中由httpGetter转为请求头
+type cachedOnlyKey struct{}
+
+func withCachedOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cachedOnlyKey{}, true)
+}
+
+func cachedOnly(ctx context.Context) bool {
+	only, _ := ctx.Value(cachedOnlyKey{}).(bool)
+	return only
+}
+
+//推送给一个副本的值
+type replicaPush struct {
+	node, group, key string
+	body             []byte
+}
+
+//有界的推送队列，有值时按需启动最多replicationWorkers个协程，队列空了之后协程退出
+type replicationQueue struct {
+	mu      sync.Mutex
+	items   []replicaPush   //等待推送的值，不包括正在推送的
+	workers int             //正在运行的推送协程数
+	pending int             //已入队还没有推送完成的值
+	closed  bool            //Shutdown之后不再接受新的推送
+	idle    []chan struct{} //等待pending变为0的调用方
+}
+
+//推送完成一个值，调用方需要持有q.mu
+func (q *replicationQueue) done() {
+	q.pending--
+	if q.pending == 0 {
+		for _, ch := range q.idle {
+			close(ch)
+		}
+		q.idle = nil
+	}
+}
+
+//返回的channel在队列中的值都推送完成后关闭
+func (q *replicationQueue) drained() <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ch := make(chan struct{})
+	if q.pending == 0 {
+		close(ch)
+	} else {
+		q.idle = append(q.idle, ch)
+	}
+	return ch
+}
+
+// Replicate 本节点是key的owner时，把值异步推送给key的其余n-1个副本节点
+// 副本与ReplicaPeers相同，配置了可用区和机架时尽量分散
+// 推送经过容量为ReplicationQueue的队列，队列满时丢弃并记录日志，每次推送最多等待ReplicationTimeout
+func (p *HTTPPool) Replicate(group, key string, value ByteView, n int) {
+	replicas := p.ReplicaPeers(key, n)
+	if len(replicas) < 2 || replicas[0] != p.self {
+		return
+	}
+	var buf bytes.Buffer
+	if err := writeBulkEntry(&buf, key, value); err != nil {
+		p.Log("replicating %s: %v", key, err)
+		return
+	}
+	for _, node := range replicas[1:] {
+		if err := p.enqueueReplica(replicaPush{node: node, group: group, key: key, body: buf.Bytes()}); err != nil {
+			p.Log("replicating %s to %s: %v, dropped", key, node, err)
+		}
+	}
+}
+
+//把值放入推送队列，协程不足时启动新的协程
+func (p *HTTPPool) enqueueReplica(push replicaPush) error {
+	q := &p.pushes
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return errors.New("pool is shutting down")
+	}
+	if len(q.items) >= p.opts.ReplicationQueue {
+		return errors.New("queue is full")
+	}
+	q.items = append(q.items, push)
+	q.pending++
+	if q.workers < replicationWorkers {
+		q.workers++
+		go p.replicationWorker()
+	}
+	return nil
+}
+
+//依次推送队列中的值，队列为空时退出，退出与最后一次done在同一次加锁中完成
+func (p *HTTPPool) replicationWorker() {
+	q := &p.pushes
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) > 0 {
+		push := q.items[0]
+		q.items[0] = replicaPush{}
+		q.items = q.items[1:]
+		q.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), p.opts.ReplicationTimeout)
+		if err := p.sendBulk(ctx, push.node, push.group, push.body); err != nil {
+			p.Log("replicating %s to %s: %v", push.key, push.node, err)
+		}
+		cancel()
+
+		q.mu.Lock()
+		q.done()
+	}
+	q.workers--
+}
+
+//等待队列中的值推送完成，ctx到期时返回ctx的错误
+func (p *HTTPPool) drainReplication(ctx context.Context) error {
+	select {
+	case <-p.pushes.drained():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//停止接受新的推送，推送协程在队列清空后退出
+func (p *HTTPPool) closeReplication() {
+	p.pushes.mu.Lock()
+	defer p.pushes.mu.Unlock()
+	p.pushes.closed = true
+}
+
+// PickReplicas 返回key除owner和当前节点以外的副本节点的客户端，按副本的顺序排列
+// 配置了ReadReplicas时至少返回所有读副本，写入和失效会同步给它们
+func (p *HTTPPool) PickReplicas(key string, n int) []PeerGetter {
+	replicas := p.ReplicaPeers(key, p.replicaCount(n))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var getters []PeerGetter
+	for i, node := range replicas {
+		if i == 0 || node == p.self {
+			continue
+		}
+		if getter, ok := p.httpGetter[node]; ok {
+			getters = append(getters, getter)
+		}
+	}
+	return getters
+}
+
+//本节点是否是key的前n个副本之一
+func (p *HTTPPool) isReplica(key string, n int) bool {
+	for _, node := range p.ReplicaPeers(key, n) {
+		if node == p.self {
+			return true
+		}
+	}
+	return false
+}
+
+var _ PeerReplicator = (*HTTPPool)(nil)
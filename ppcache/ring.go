@@ -0,0 +1,96 @@
+// Package ppcache
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// 节点间校验哈希环是否一致，并限制请求的转发次数
+package ppcache
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+const (
+	ringHeader = "X-Ppcache-Ring" //请求方的哈希环指纹
+	hopsHeader = "X-Ppcache-Hops" //请求已经经过的节点数
+
+	defaultMaxHops = 2 //默认的最大转发次数
+)
+
+//计算哈希环的指纹，peers需要按地址排序
+//只包含决定key归属的内容：节点地址、权重和虚拟节点倍数，以及依赖添加顺序的选择算法中节点的顺序order
+func ringFingerprint(replicas int, peers []Peer, order []string) uint64 {
+	h := fnv.New64a()
+	buf := strconv.AppendInt(nil, int64(replicas), 10)
+	for _, peer := range peers {
+		buf = append(buf, '\n')
+		buf = append(buf, peer.Addr...)
+		buf = append(buf, 0)
+		buf = strconv.AppendInt(buf, int64(peer.Weight), 10)
+	}
+	for _, node := range order {
+		buf = append(buf, '\n', '#')
+		buf = append(buf, node...)
+	}
+	h.Write(buf)
+	return h.Sum64()
+}
+
+//格式化为请求头中的十六进制
+func formatFingerprint(fp uint64) string {
+	return strconv.FormatUint(fp, 16)
+}
+
+// RingMismatches 返回收到的请求中哈希环指纹与本节点不一致的次数
+// 持续增长说明节点之间的成员列表不一致，请求可能在节点之间来回转发或被重复加载
+func (p *HTTPPool) RingMismatches() uint64 {
+	return atomic.LoadUint64(&p.mismatches)
+}
+
+//检查请求方的哈希环是否与本节点一致，没有携带指纹的请求不是来自其他节点，视为一致
+func (p *HTTPPool) checkRing(r *http.Request) bool {
+	remote := r.Header.Get(ringHeader)
+	if remote == "" {
+		return true
+	}
+	if remote == formatFingerprint(p.Membership().Fingerprint) {
+		return true
+	}
+	atomic.AddUint64(&p.mismatches, 1)
+	p.Log("ring fingerprint mismatch: local %s, remote %s", formatFingerprint(p.Membership().Fingerprint), remote)
+	return false
+}
+
+//请求经过的节点数，保存在context中随请求传给下一个节点
+type hopsKey struct{}
+
+func withHops(ctx context.Context, hops int) context.Context {
+	return context.WithValue(ctx, hopsKey{}, hops)
+}
+
+func hopsFrom(ctx context.Context) int {
+	hops, _ := ctx.Value(hopsKey{}).(int)
+	return hops
+}
+
+//环状态的JSON格式
+type ringStatus struct {
+	Version     uint64 `json:"version"`
+	Fingerprint string `json:"fingerprint"`
+	Mismatches  uint64 `json:"mismatches"`
+	Peers       []Peer `json:"peers"`
+}
+
+func (p *HTTPPool) serveRing(w http.ResponseWriter, r *http.Request) {
+	view := p.Membership()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ringStatus{
+		Version:     view.Version,
+		Fingerprint: formatFingerprint(view.Fingerprint),
+		Mismatches:  p.RingMismatches(),
+		Peers:       view.Peers,
+	})
+}
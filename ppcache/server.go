@@ -0,0 +1,174 @@
+// Package ppcache
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// 节点服务，支持优雅退出
+package ppcache
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+)
+
+// ServerOptions Server的配置项
+type ServerOptions struct {
+	//退出前把缓存交给其他节点，需要其他节点已经或即将从成员列表中删除本节点
+	//接收方只接受签名的推送，所有节点需要配置相同的HTTPPoolOptions.Secrets
+	Handoff bool
+	//退出时通知其他节点本节点正在离开，例如调用gossip的Leave，按注册的顺序执行
+	OnLeave []func(ctx context.Context) error
+}
+
+// Server 对外提供HTTPPool的节点服务，Shutdown时先排空请求再退出
+type Server struct {
+	draining int32          //不为0时拒绝新的节点请求，放在第一个字段以保证原子操作的对齐
+	pool     *HTTPPool      //处理节点请求
+	opts     ServerOptions  //配置项
+	inflight sync.WaitGroup //正在处理的节点请求，包括其中的加载
+	mu       sync.RWMutex   //开始退出时持有写锁，保证之后不再有新的请求加入inflight；同时保护srv
+	srv      *http.Server   //底层的http服务，开始监听后才不为nil
+}
+
+// NewServer 创建pool的节点服务，o为nil时使用默认配置
+func NewServer(pool *HTTPPool, o *ServerOptions) *Server {
+	s := &Server{pool: pool}
+	if o != nil {
+		s.opts = *o
+	}
+	return s
+}
+
+// OnLeave 添加退出时执行的通知，需要在Shutdown之前调用
+func (s *Server) OnLeave(fn func(ctx context.Context) error) {
+	s.opts.OnLeave = append(s.opts.OnLeave, fn)
+}
+
+// Draining 是否已经开始退出
+func (s *Server) Draining() bool {
+	return atomic.LoadInt32(&s.draining) != 0
+}
+
+//开始退出后新的节点请求返回UNAVAILABLE，请求方会自己从数据源加载
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.begin() {
+		writeError(w, fmt.Errorf("node is shutting down: %w", ErrUnavailable))
+		return
+	}
+	defer s.inflight.Done()
+	s.pool.ServeHTTP(w, r)
+}
+
+//没有开始退出时把请求加入inflight
+func (s *Server) begin() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.Draining() {
+		return false
+	}
+	s.inflight.Add(1)
+	return true
+}
+
+// ListenAndServe 在pool的地址上开始监听，启用tls时使用https，Shutdown后返回http.ErrServerClosed
+func (s *Server) ListenAndServe() error {
+	u, err := url.Parse(s.pool.self)
+	if err != nil {
+		return fmt.Errorf("parsing self address: %v", err)
+	}
+	l, err := net.Listen("tcp", u.Host)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve 在l上提供服务，启用tls时使用https，Shutdown后返回http.ErrServerClosed
+func (s *Server) Serve(l net.Listener) error {
+	srv := &http.Server{Handler: s, TLSConfig: s.pool.TLSConfig()}
+	s.mu.Lock()
+	if s.Draining() {
+		s.mu.Unlock()
+		l.Close()
+		return http.ErrServerClosed
+	}
+	s.srv = srv
+	s.mu.Unlock()
+	if srv.TLSConfig == nil {
+		return srv.Serve(l)
+	}
+	if err := s.pool.ReloadCertificates(); err != nil {
+		l.Close()
+		return err
+	}
+	return srv.ServeTLS(l, "", "")
+}
+
+// Shutdown 优雅退出：
+//  1. 新的节点请求返回UNAVAILABLE，请求方改为自己加载
+//  2. 执行OnLeave通知其他节点
+//  3. 等待正在处理的请求和其中的加载完成
+//  4. 停止接受新的副本推送，等待已经加载的值推送给副本
+//  5. 配置了Handoff时把缓存推给新的owner
+//  6. 关闭监听和空闲连接
+//
+// ctx到期时停止等待并关闭服务，返回ctx的错误
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	atomic.StoreInt32(&s.draining, 1)
+	srv := s.srv
+	s.mu.Unlock()
+
+	var firstErr error
+	for _, leave := range s.opts.OnLeave {
+		if err := leave(ctx); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("announcing leave: %v", err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if srv != nil {
+			srv.Close()
+		}
+		return ctx.Err()
+	}
+
+	s.pool.closeReplication()
+	if err := s.pool.drainReplication(ctx); err != nil {
+		if srv != nil {
+			srv.Close()
+		}
+		return err
+	}
+
+	if s.opts.Handoff {
+		//从自己的环中删除自己，不再属于本节点的key就是所有的key
+		s.pool.beginHandoff()
+		s.pool.RemovePeers(s.pool.self)
+		if moved, err := s.pool.Rebalance(ctx); err != nil {
+			s.pool.Log("handoff: moved %d keys: %v", moved, err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("handing off keys: %v", err)
+			}
+		} else {
+			s.pool.Log("handoff: moved %d keys", moved)
+		}
+	}
+
+	if srv != nil {
+		if err := srv.Shutdown(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,88 @@
+// Package ppcache
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// 哈希槽模式下的请求路由，槽不属于当前节点时返回MOVED或ASK重定向
+package ppcache
+
+import (
+	"fmt"
+	"net/http"
+	"ppcache/consistenthash"
+	"strconv"
+	"strings"
+)
+
+const (
+	askingHeader = "X-Ppcache-Asking" //按ASK重定向或有界负载发出的请求，目标节点即使还不是owner也直接加载
+	maxRedirects = 5                  //单次请求最多跟随的重定向次数
+)
+
+// SlotTable 使用哈希槽选择节点时返回槽表，可以直接调用Assign、Migrate等方法调整，其他选择算法返回nil
+func (p *HTTPPool) SlotTable() *consistenthash.Slots {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	slots, _ := p.peers.(*consistenthash.Slots)
+	return slots
+}
+
+//按槽表处理远程节点的请求
+//槽属于当前节点时正常读取；正在迁出时只返回本地已有的缓存，其余的key返回ASK；
+//槽正在迁入并且请求带有Asking标记时直接从本地加载；其他情况返回MOVED
+func (p *HTTPPool) getSlot(slots *consistenthash.Slots, r *http.Request, group *Group, key string) (ByteView, error) {
+	slot := slots.Slot(p.opts.HashTag.Extract(key))
+	owner := slots.Owner(slot)
+	to, migrating := slots.Migrating(slot)
+	switch {
+	case owner == p.self && migrating:
+		if v, ok := group.mainCache.get(key); ok {
+			return v, nil
+		}
+		return ByteView{}, &redirectError{ask: true, slot: slot, addr: to}
+	case owner == p.self:
+		return group.Get(key)
+	case migrating && to == p.self && r.Header.Get(askingHeader) != "":
+		return group.getLocal(key)
+	case owner == "":
+		return ByteView{}, fmt.Errorf("slot %d is not assigned: %w", slot, ErrUnavailable)
+	}
+	return ByteView{}, &redirectError{slot: slot, addr: owner}
+}
+
+//收到MOVED后按对方给出的节点更新本地的槽表，只接受已知的节点
+//只更新这一个槽，不会让自动分配的槽表变为显式分配
+func (p *HTTPPool) slotMoved(key, addr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	slots, ok := p.peers.(*consistenthash.Slots)
+	if !ok {
+		return
+	}
+	if _, known := p.httpGetter[addr]; !known {
+		return
+	}
+	slots.Moved(addr, slots.Slot(p.opts.HashTag.Extract(key)))
+}
+
+//解析 N 或 N-M 形式的槽
+func parseSlots(s string) ([]int, error) {
+	lo, hi := s, s
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		lo, hi = s[:i], s[i+1:]
+	}
+	start, err := strconv.Atoi(lo)
+	if err != nil {
+		return nil, err
+	}
+	end, err := strconv.Atoi(hi)
+	if err != nil {
+		return nil, err
+	}
+	if start < 0 || end >= consistenthash.SlotCount || start > end {
+		return nil, fmt.Errorf("slot range %s out of [0, %d)", s, consistenthash.SlotCount)
+	}
+	slots := make([]int, 0, end-start+1)
+	for slot := start; slot <= end; slot++ {
+		slots = append(slots, slot)
+	}
+	return slots, nil
+}
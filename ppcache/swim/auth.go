@@ -0,0 +1,85 @@
+// Package swim
+// @author    : MuXiang123
+// @time      : 2026/10/19 14:04
+// gossip消息的HMAC签名，防止伪造的消息修改成员列表，并拒绝时间窗口外和重复的消息
+package swim
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"time"
+)
+
+const defaultMaxClockSkew = 30 * time.Second //默认允许的时钟偏差
+
+var (
+	errUnsigned = errors.New("swim: message is not signed")
+	errBadMAC   = errors.New("swim: invalid message signature")
+	errStale    = errors.New("swim: message timestamp out of range")
+	errReplayed = errors.New("swim: replayed message")
+)
+
+//对消息签名和验签，secrets为空时不签名
+type sealer struct {
+	secrets [][]byte      //第一个密钥用于签名，所有密钥都可以通过验签，用于密钥轮换
+	skew    time.Duration //允许的时钟偏差，同时也是防重放的时间窗口
+	seen    map[string]time.Time
+	pruned  time.Time
+}
+
+func newSealer(secrets [][]byte, skew time.Duration) *sealer {
+	if len(secrets) == 0 {
+		return nil
+	}
+	if skew <= 0 {
+		skew = defaultMaxClockSkew
+	}
+	return &sealer{secrets: secrets, skew: skew, seen: make(map[string]time.Time)}
+}
+
+func mac(secret, data []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+//在json编码的消息前加上HMAC-SHA256
+func (s *sealer) seal(data []byte) []byte {
+	return append(mac(s.secrets[0], data), data...)
+}
+
+//校验签名并返回json编码的消息
+func (s *sealer) open(packet []byte) ([]byte, error) {
+	if len(packet) < sha256.Size {
+		return nil, errUnsigned
+	}
+	sum, data := packet[:sha256.Size], packet[sha256.Size:]
+	for _, secret := range s.secrets {
+		if hmac.Equal(sum, mac(secret, data)) {
+			return data, nil
+		}
+	}
+	return nil, errBadMAC
+}
+
+//检查已经验签的消息的时间戳，并拒绝时间窗口内重复的消息，调用方需要持有n.mu
+func (s *sealer) check(packet []byte, sent, now time.Time) error {
+	if sent.Before(now.Add(-s.skew)) || sent.After(now.Add(s.skew)) {
+		return errStale
+	}
+	if now.Sub(s.pruned) > s.skew {
+		for k, expire := range s.seen {
+			if now.After(expire) {
+				delete(s.seen, k)
+			}
+		}
+		s.pruned = now
+	}
+	key := string(packet[:sha256.Size])
+	if _, ok := s.seen[key]; ok {
+		return errReplayed
+	}
+	s.seen[key] = sent.Add(s.skew)
+	return nil
+}
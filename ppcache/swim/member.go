@@ -0,0 +1,123 @@
+// Package swim
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// 成员的状态，以及节点间交换的消息
+package swim
+
+import (
+	"math"
+	"sort"
+)
+
+// State 成员的状态
+type State int
+
+const (
+	StateAlive   State = iota //正常
+	StateSuspect              //没有响应探测，等待自己反驳或超时后判定为失效
+	StateDead                 //判定为失效
+	StateLeft                 //主动离开
+)
+
+func (s State) String() string {
+	switch s {
+	case StateAlive:
+		return "alive"
+	case StateSuspect:
+		return "suspect"
+	case StateDead:
+		return "dead"
+	case StateLeft:
+		return "left"
+	}
+	return "unknown"
+}
+
+//alive和suspect的成员仍然属于集群
+func (s State) up() bool {
+	return s == StateAlive || s == StateSuspect
+}
+
+// Member 集群中的一个成员
+type Member struct {
+	Name        string `json:"name"`             //名称，同时是HTTPPool中的节点地址，例如 http://10.0.0.2:8001
+	Addr        string `json:"addr"`             //gossip使用的udp地址
+	Weight      int    `json:"weight,omitempty"` //节点权重
+	Zone        string `json:"zone,omitempty"`   //可用区
+	Rack        string `json:"rack,omitempty"`   //机架
+	State       State  `json:"state"`
+	Incarnation uint64 `json:"incarnation"` //成员自己维护的版本号，只有本人可以增加，用来反驳怀疑
+}
+
+//除状态以外的信息是否相同
+func (m Member) sameMeta(o Member) bool {
+	return m.Addr == o.Addr && m.Weight == o.Weight && m.Zone == o.Zone && m.Rack == o.Rack
+}
+
+const (
+	msgPing    = "ping"     //直接探测
+	msgAck     = "ack"      //探测的应答
+	msgPingReq = "ping-req" //请其他成员代为探测Target
+	msgSync    = "sync"     //加入时交换全部成员状态
+	msgSyncAck = "sync-ack" //sync的应答，携带对方的全部成员状态
+	msgGossip  = "gossip"   //只传播状态变化，不需要应答
+)
+
+//节点间的udp消息，使用json编码
+type message struct {
+	Type       string   `json:"type"`
+	Seq        uint64   `json:"seq,omitempty"`
+	From       string   `json:"from"`
+	Time       int64    `json:"time,omitempty"`        //发送时间，unix纳秒，签名时用于拒绝过期和重复的消息
+	Target     string   `json:"target,omitempty"`      //ping-req探测的成员
+	TargetAddr string   `json:"target_addr,omitempty"` //ping-req探测的成员的地址
+	Updates    []Member `json:"updates,omitempty"`     //捎带的状态变化
+	State      []Member `json:"state,omitempty"`       //sync和sync-ack中的全部成员
+}
+
+//待传播的状态变化
+type broadcast struct {
+	member    Member
+	transmits int //已经发送的次数
+}
+
+//待传播的状态变化队列，同一个成员只保留最新的一条
+type broadcastQueue struct {
+	items []*broadcast
+}
+
+//加入一条状态变化，替换同一个成员的旧消息
+func (q *broadcastQueue) add(m Member) {
+	for i, b := range q.items {
+		if b.member.Name == m.Name {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			break
+		}
+	}
+	q.items = append(q.items, &broadcast{member: m})
+}
+
+//取出最多limit条发送次数最少的消息，每条消息最多发送 mult*log10(n+1) 次，保证以很高的概率传遍集群
+func (q *broadcastQueue) take(limit, mult, n int) []Member {
+	if len(q.items) == 0 {
+		return nil
+	}
+	sort.SliceStable(q.items, func(i, j int) bool { return q.items[i].transmits < q.items[j].transmits })
+	max := mult * int(math.Ceil(math.Log10(float64(n+1))))
+	if max < 1 {
+		max = 1
+	}
+	var out []Member
+	kept := q.items[:0]
+	for _, b := range q.items {
+		if len(out) < limit {
+			out = append(out, b.member)
+			b.transmits++
+		}
+		if b.transmits < max {
+			kept = append(kept, b)
+		}
+	}
+	q.items = kept
+	return out
+}
@@ -0,0 +1,19 @@
+// Package swim
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// 用成员变化更新HTTPPool中的节点
+package swim
+
+import "ppcache"
+
+// UpdatePool 返回可以作为Config.OnChange的回调：成员加入时加入pool，失效或离开时从pool中删除
+// 成员名称需要是HTTPPool使用的节点地址
+func UpdatePool(pool *ppcache.HTTPPool) func(Member) {
+	return func(m Member) {
+		if m.State.up() {
+			pool.AddPeers(ppcache.Peer{Addr: m.Name, Weight: m.Weight, Zone: m.Zone, Rack: m.Rack})
+			return
+		}
+		pool.RemovePeers(m.Name)
+	}
+}
@@ -0,0 +1,640 @@
+// Package swim
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// 基于SWIM协议的集群成员管理：通过种子节点加入，直接探测和间接探测发现故障，
+// 先怀疑再判定失效，状态变化捎带在探测消息中以gossip的方式传播
+package swim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultProbeInterval  = time.Second            //默认探测间隔
+	defaultProbeTimeout   = 500 * time.Millisecond //默认等待应答的时间
+	defaultIndirectChecks = 3                      //默认间接探测的成员数
+	defaultRetransmitMult = 4                      //默认的重传倍数
+	defaultDeadRetention  = 30 * time.Second       //默认失效成员的保留时间
+	defaultSyncInterval   = 30 * time.Second       //默认与随机成员交换全部状态的间隔
+	maxPiggyback          = 16                     //每条消息最多捎带的状态变化
+	maxPacketSize         = 64 << 10               //udp消息的最大长度
+)
+
+// Config 节点的配置，零值字段使用默认值
+type Config struct {
+	Name          string //节点名称，集群内唯一，一般使用HTTPPool的self地址
+	BindAddr      string //监听的udp地址，例如 0.0.0.0:7946，端口为0时随机分配
+	AdvertiseAddr string //其他成员访问自己使用的udp地址，默认为实际监听的地址
+	Weight        int    //节点权重
+	Zone          string //可用区
+	Rack          string //机架
+
+	ProbeInterval    time.Duration //每隔多久探测一个成员，默认1秒
+	ProbeTimeout     time.Duration //等待直接探测应答的时间，超时后发起间接探测，默认500毫秒
+	IndirectChecks   int           //间接探测时请求的成员数，默认3
+	SuspicionTimeout time.Duration //被怀疑的成员多久没有反驳就判定为失效，默认为5个探测间隔
+	RetransmitMult   int           //每条状态变化的重传倍数，默认4
+	DeadRetention    time.Duration //失效和离开的成员保留多久，期间忽略旧的alive消息，默认30秒
+	SyncInterval     time.Duration //每隔多久与一个随机成员交换全部状态，弥补gossip丢失的消息，默认30秒，小于0表示关闭
+
+	//集群共享的HMAC密钥，一般与HTTPPoolOptions.Secrets相同；不为空时对消息签名，
+	//丢弃签名无效、时间窗口外和重复的消息，第一个用于签名，其余只用于验签以便轮换
+	Secrets      [][]byte
+	MaxClockSkew time.Duration //签名允许的时钟偏差，同时是防重放的时间窗口，默认30秒
+
+	//成员加入、失效、离开或者元数据变化时按发生的顺序调用，包括自己加入
+	OnChange func(Member)
+	//日志输出，默认为log.Printf
+	Logf func(format string, v ...interface{})
+}
+
+//填充未设置的配置项
+func (c *Config) setDefaults() {
+	if c.ProbeInterval == 0 {
+		c.ProbeInterval = defaultProbeInterval
+	}
+	if c.ProbeTimeout == 0 {
+		c.ProbeTimeout = defaultProbeTimeout
+	}
+	if c.ProbeTimeout >= c.ProbeInterval {
+		c.ProbeTimeout = c.ProbeInterval / 2
+	}
+	if c.IndirectChecks == 0 {
+		c.IndirectChecks = defaultIndirectChecks
+	}
+	if c.SuspicionTimeout == 0 {
+		c.SuspicionTimeout = 5 * c.ProbeInterval
+	}
+	if c.RetransmitMult == 0 {
+		c.RetransmitMult = defaultRetransmitMult
+	}
+	if c.DeadRetention == 0 {
+		c.DeadRetention = defaultDeadRetention
+	}
+	if c.SyncInterval == 0 {
+		c.SyncInterval = defaultSyncInterval
+	}
+	if c.Weight < 1 {
+		c.Weight = 1
+	}
+	if c.Logf == nil {
+		c.Logf = log.Printf
+	}
+}
+
+//其他成员的状态
+type memberState struct {
+	Member
+	changed time.Time   //最近一次状态变化的时间
+	suspect *time.Timer //怀疑的超时定时器
+}
+
+// Node 集群中的一个节点
+type Node struct {
+	conf Config
+	conn *net.UDPConn
+
+	mu        sync.Mutex
+	self      Member
+	members   map[string]*memberState //除自己以外的成员
+	probeList []string                //本轮探测的顺序
+	probeIdx  int
+	seq       uint64
+	acks      map[uint64]func(*message) //等待应答的请求
+	queue     broadcastQueue
+	leaving   bool
+	sealer    *sealer //配置了Secrets时对消息签名和验签
+
+	events  []Member      //待通知的成员变化
+	notify  chan struct{} //有新的成员变化
+	done    chan struct{}
+	wg      sync.WaitGroup
+	stopped sync.Once
+}
+
+// Start 监听udp地址并开始探测，之后调用Join加入集群
+func Start(conf Config) (*Node, error) {
+	if conf.Name == "" {
+		return nil, errors.New("swim: node name is required")
+	}
+	conf.setDefaults()
+	addr, err := net.ResolveUDPAddr("udp", conf.BindAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if conf.AdvertiseAddr == "" {
+		conf.AdvertiseAddr = conn.LocalAddr().String()
+	}
+	n := &Node{
+		conf: conf,
+		conn: conn,
+		self: Member{
+			Name:   conf.Name,
+			Addr:   conf.AdvertiseAddr,
+			Weight: conf.Weight,
+			Zone:   conf.Zone,
+			Rack:   conf.Rack,
+			State:  StateAlive,
+		},
+		members: make(map[string]*memberState),
+		acks:    make(map[uint64]func(*message)),
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		sealer:  newSealer(conf.Secrets, conf.MaxClockSkew),
+	}
+	n.mu.Lock()
+	//加入集群后由其他成员继续传播自己的alive消息
+	n.queue.add(n.self)
+	n.emit(n.self)
+	n.mu.Unlock()
+	n.wg.Add(3)
+	go n.receiveLoop()
+	go n.probeLoop()
+	go n.eventLoop()
+	return n, nil
+}
+
+// LocalAddr 返回其他成员访问自己使用的udp地址
+func (n *Node) LocalAddr() string {
+	return n.conf.AdvertiseAddr
+}
+
+// Join 通过种子节点加入集群，与每个种子交换全部成员状态，至少一个种子应答时返回成功
+func (n *Node) Join(seeds ...string) (int, error) {
+	joined := 0
+	var lastErr error
+	for _, seed := range seeds {
+		if seed == n.conf.AdvertiseAddr {
+			continue
+		}
+		if err := n.sync(seed); err != nil {
+			lastErr = err
+			continue
+		}
+		joined++
+	}
+	if joined == 0 && lastErr != nil {
+		return 0, fmt.Errorf("swim: no seed answered: %v", lastErr)
+	}
+	return joined, nil
+}
+
+//与addr交换全部成员状态
+func (n *Node) sync(addr string) error {
+	seq, ack := n.expectAck()
+	defer n.clearAck(seq)
+	n.mu.Lock()
+	state := n.snapshot()
+	n.mu.Unlock()
+	if err := n.send(addr, &message{Type: msgSync, Seq: seq, State: state}); err != nil {
+		return err
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-time.After(4 * n.conf.ProbeTimeout):
+		return fmt.Errorf("sync with %s timed out", addr)
+	case <-n.done:
+		return errors.New("swim: node is shut down")
+	}
+}
+
+// Members 返回集群中仍然存活的成员，包括自己和被怀疑的成员，按名称排序
+func (n *Node) Members() []Member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	out := []Member{n.self}
+	for _, m := range n.members {
+		if m.State.up() {
+			out = append(out, m.Member)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Leave 通知其他成员自己主动离开，然后停止节点
+func (n *Node) Leave() error {
+	n.mu.Lock()
+	n.leaving = true
+	n.self.Incarnation++
+	n.self.State = StateLeft
+	left := n.self
+	var addrs []string
+	for _, m := range n.members {
+		if m.State.up() {
+			addrs = append(addrs, m.Addr)
+		}
+	}
+	n.mu.Unlock()
+	//直接发给所有成员，不等待下一次探测
+	for _, addr := range addrs {
+		n.sendRaw(addr, &message{Type: msgGossip, Updates: []Member{left}})
+	}
+	return n.Shutdown()
+}
+
+// Shutdown 停止节点，不通知其他成员，其他成员会通过探测发现它失效
+func (n *Node) Shutdown() error {
+	var err error
+	n.stopped.Do(func() {
+		close(n.done)
+		err = n.conn.Close()
+		n.wg.Wait()
+		n.mu.Lock()
+		for _, m := range n.members {
+			if m.suspect != nil {
+				m.suspect.Stop()
+			}
+		}
+		n.mu.Unlock()
+	})
+	return err
+}
+
+//发送消息，捎带待传播的状态变化
+func (n *Node) send(addr string, msg *message) error {
+	n.mu.Lock()
+	msg.Updates = append(msg.Updates, n.queue.take(maxPiggyback, n.conf.RetransmitMult, len(n.members)+1)...)
+	n.mu.Unlock()
+	return n.sendRaw(addr, msg)
+}
+
+func (n *Node) sendRaw(addr string, msg *message) error {
+	msg.From = n.conf.Name
+	msg.Time = time.Now().UnixNano()
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if n.sealer != nil {
+		data = n.sealer.seal(data)
+	}
+	if len(data) > maxPacketSize {
+		return fmt.Errorf("swim: %s message of %d bytes exceeds the udp limit", msg.Type, len(data))
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	_, err = n.conn.WriteToUDP(data, udpAddr)
+	return err
+}
+
+//注册一个等待应答的序号，收到应答时向返回的channel发送信号
+func (n *Node) expectAck() (uint64, chan struct{}) {
+	ch := make(chan struct{}, 1)
+	seq := n.onAck(func(*message) {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	})
+	return seq, ch
+}
+
+func (n *Node) onAck(fn func(*message)) uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.seq++
+	n.acks[n.seq] = fn
+	return n.seq
+}
+
+func (n *Node) clearAck(seq uint64) {
+	n.mu.Lock()
+	delete(n.acks, seq)
+	n.mu.Unlock()
+}
+
+func (n *Node) receiveLoop() {
+	defer n.wg.Done()
+	buf := make([]byte, maxPacketSize)
+	for {
+		size, from, err := n.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-n.done:
+				return
+			default:
+			}
+			n.conf.Logf("[swim %s] read: %v", n.conf.Name, err)
+			continue
+		}
+		msg, err := n.decode(buf[:size])
+		if err != nil {
+			n.conf.Logf("[swim %s] bad message from %s: %v", n.conf.Name, from, err)
+			continue
+		}
+		n.handle(msg, from.String())
+	}
+}
+
+//解码收到的消息，配置了Secrets时先验签，再检查时间戳和是否重复
+func (n *Node) decode(packet []byte) (*message, error) {
+	data := packet
+	if n.sealer != nil {
+		var err error
+		if data, err = n.sealer.open(packet); err != nil {
+			return nil, err
+		}
+	}
+	msg := &message{}
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	if n.sealer != nil {
+		n.mu.Lock()
+		err := n.sealer.check(packet, time.Unix(0, msg.Time), time.Now())
+		n.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+//处理收到的消息
+func (n *Node) handle(msg *message, from string) {
+	n.mu.Lock()
+	for _, u := range msg.Updates {
+		n.apply(u)
+	}
+	for _, u := range msg.State {
+		n.apply(u)
+	}
+	var ack func(*message)
+	if msg.Type == msgAck || msg.Type == msgSyncAck {
+		ack = n.acks[msg.Seq]
+	}
+	n.mu.Unlock()
+
+	switch msg.Type {
+	case msgPing:
+		n.send(from, &message{Type: msgAck, Seq: msg.Seq})
+	case msgAck, msgSyncAck:
+		if ack != nil {
+			ack(msg)
+		}
+	case msgPingReq:
+		//只代为探测已知的成员，避免被利用向任意地址发送消息
+		n.mu.Lock()
+		target, known := n.members[msg.Target]
+		known = known && target.State.up() && target.Addr == msg.TargetAddr
+		n.mu.Unlock()
+		if !known {
+			n.conf.Logf("[swim %s] ignoring ping-req for unknown member %s at %s", n.conf.Name, msg.Target, msg.TargetAddr)
+			return
+		}
+		//代为探测，收到目标的应答后转发给请求方
+		seq := n.onAck(func(*message) {
+			n.send(from, &message{Type: msgAck, Seq: msg.Seq})
+		})
+		time.AfterFunc(n.conf.ProbeInterval, func() { n.clearAck(seq) })
+		n.send(msg.TargetAddr, &message{Type: msgPing, Seq: seq})
+	case msgSync:
+		n.mu.Lock()
+		state := n.snapshot()
+		n.mu.Unlock()
+		n.send(from, &message{Type: msgSyncAck, Seq: msg.Seq, State: state})
+	}
+}
+
+//全部成员的状态，调用方需要持有n.mu
+func (n *Node) snapshot() []Member {
+	state := []Member{n.self}
+	for _, m := range n.members {
+		state = append(state, m.Member)
+	}
+	return state
+}
+
+//合并一条成员状态，状态有变化时继续传播，调用方需要持有n.mu
+//incarnation大的消息覆盖小的；相同时suspect覆盖alive，dead和left覆盖suspect
+func (n *Node) apply(u Member) {
+	if u.Name == n.conf.Name {
+		//其他成员怀疑自己或认为自己已经失效，增加incarnation反驳
+		if !n.leaving && u.State != StateAlive && u.Incarnation >= n.self.Incarnation {
+			n.self.Incarnation = u.Incarnation + 1
+			n.queue.add(n.self)
+			n.conf.Logf("[swim %s] refuting %s at incarnation %d", n.conf.Name, u.State, n.self.Incarnation)
+		}
+		return
+	}
+	cur, known := n.members[u.Name]
+	if !known {
+		//不知道的成员失效或离开时也记录下来，防止之后收到旧的alive消息
+		cur = &memberState{Member: u, changed: time.Now()}
+		n.members[u.Name] = cur
+		n.queue.add(u)
+		if u.State == StateSuspect {
+			n.startSuspicion(cur)
+		}
+		if u.State.up() {
+			n.emit(u)
+		}
+		return
+	}
+	switch u.State {
+	case StateAlive:
+		if u.Incarnation <= cur.Incarnation {
+			return
+		}
+	case StateSuspect:
+		if u.Incarnation < cur.Incarnation || !cur.State.up() ||
+			(cur.State == StateSuspect && u.Incarnation == cur.Incarnation) {
+			return
+		}
+	case StateDead, StateLeft:
+		if u.Incarnation < cur.Incarnation || !cur.State.up() {
+			return
+		}
+	default:
+		return
+	}
+	prev := cur.Member
+	cur.Member = u
+	cur.changed = time.Now()
+	if cur.suspect != nil {
+		cur.suspect.Stop()
+		cur.suspect = nil
+	}
+	if u.State == StateSuspect {
+		n.startSuspicion(cur)
+	}
+	n.queue.add(u)
+	if prev.State.up() != u.State.up() || (u.State.up() && !prev.sameMeta(u)) {
+		n.emit(u)
+	}
+}
+
+//被怀疑的成员超时没有反驳时判定为失效，调用方需要持有n.mu
+func (n *Node) startSuspicion(m *memberState) {
+	incarnation := m.Incarnation
+	m.suspect = time.AfterFunc(n.conf.SuspicionTimeout, func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		if m.State == StateSuspect && m.Incarnation == incarnation {
+			dead := m.Member
+			dead.State = StateDead
+			n.conf.Logf("[swim %s] %s is dead", n.conf.Name, m.Name)
+			n.apply(dead)
+		}
+	})
+}
+
+//记录一次成员变化，由eventLoop按顺序通知，调用方需要持有n.mu
+func (n *Node) emit(m Member) {
+	if n.conf.OnChange == nil {
+		return
+	}
+	n.events = append(n.events, m)
+	select {
+	case n.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (n *Node) eventLoop() {
+	defer n.wg.Done()
+	for {
+		select {
+		case <-n.notify:
+		case <-n.done:
+			return
+		}
+		n.mu.Lock()
+		events := n.events
+		n.events = nil
+		n.mu.Unlock()
+		for _, m := range events {
+			n.conf.OnChange(m)
+		}
+	}
+}
+
+func (n *Node) probeLoop() {
+	defer n.wg.Done()
+	ticker := time.NewTicker(n.conf.ProbeInterval)
+	defer ticker.Stop()
+	lastSync := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+			n.probe()
+			n.reap()
+			if n.conf.SyncInterval > 0 && time.Since(lastSync) >= n.conf.SyncInterval {
+				lastSync = time.Now()
+				if peers := n.randomMembers(1, ""); len(peers) > 0 {
+					n.sync(peers[0].Addr)
+				}
+			}
+		case <-n.done:
+			return
+		}
+	}
+}
+
+//选择下一个探测的成员，每一轮打乱一次顺序，保证每个成员在有限时间内都会被探测到
+func (n *Node) nextTarget() (Member, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for tries := 0; tries < 2; tries++ {
+		for n.probeIdx < len(n.probeList) {
+			m, ok := n.members[n.probeList[n.probeIdx]]
+			n.probeIdx++
+			if ok && m.State.up() {
+				return m.Member, true
+			}
+		}
+		n.probeList = n.probeList[:0]
+		for name, m := range n.members {
+			if m.State.up() {
+				n.probeList = append(n.probeList, name)
+			}
+		}
+		rand.Shuffle(len(n.probeList), func(i, j int) {
+			n.probeList[i], n.probeList[j] = n.probeList[j], n.probeList[i]
+		})
+		n.probeIdx = 0
+	}
+	return Member{}, false
+}
+
+//随机选择最多k个存活的成员，不包括exclude
+func (n *Node) randomMembers(k int, exclude string) []Member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var candidates []Member
+	for name, m := range n.members {
+		if name != exclude && m.State == StateAlive {
+			candidates = append(candidates, m.Member)
+		}
+	}
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	return candidates
+}
+
+//探测一个成员：先直接ping，超时后请其他成员间接探测，到本轮结束仍没有应答则开始怀疑
+func (n *Node) probe() {
+	target, ok := n.nextTarget()
+	if !ok {
+		return
+	}
+	seq, ack := n.expectAck()
+	defer n.clearAck(seq)
+	if err := n.send(target.Addr, &message{Type: msgPing, Seq: seq}); err != nil {
+		n.conf.Logf("[swim %s] ping %s: %v", n.conf.Name, target.Name, err)
+	}
+	select {
+	case <-ack:
+		return
+	case <-time.After(n.conf.ProbeTimeout):
+	case <-n.done:
+		return
+	}
+	for _, m := range n.randomMembers(n.conf.IndirectChecks, target.Name) {
+		n.send(m.Addr, &message{Type: msgPingReq, Seq: seq, Target: target.Name, TargetAddr: target.Addr})
+	}
+	select {
+	case <-ack:
+		return
+	case <-time.After(n.conf.ProbeInterval - n.conf.ProbeTimeout):
+	case <-n.done:
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if cur, ok := n.members[target.Name]; ok && cur.State == StateAlive && cur.Incarnation == target.Incarnation {
+		suspect := cur.Member
+		suspect.State = StateSuspect
+		n.conf.Logf("[swim %s] suspect %s", n.conf.Name, target.Name)
+		n.apply(suspect)
+	}
+}
+
+//删除保留时间已过的失效成员
+func (n *Node) reap() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for name, m := range n.members {
+		if !m.State.up() && time.Since(m.changed) > n.conf.DeadRetention {
+			delete(n.members, name)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+// Package swim
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+package swim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"ppcache"
+	"testing"
+	"time"
+)
+
+//在本机上启动n个节点，使用很短的探测间隔
+func startNodes(t *testing.T, n int, onChange func(i int) func(Member)) []*Node {
+	return startSecretNodes(t, n, nil, onChange)
+}
+
+//与startNodes相同，secrets不为空时对消息签名
+func startSecretNodes(t *testing.T, n int, secrets [][]byte, onChange func(i int) func(Member)) []*Node {
+	t.Helper()
+	nodes := make([]*Node, n)
+	for i := range nodes {
+		conf := Config{
+			Secrets:          secrets,
+			Name:             fmt.Sprintf("http://127.0.0.1:%d", 18001+i),
+			BindAddr:         "127.0.0.1:0",
+			ProbeInterval:    50 * time.Millisecond,
+			ProbeTimeout:     20 * time.Millisecond,
+			SuspicionTimeout: 250 * time.Millisecond,
+			SyncInterval:     500 * time.Millisecond,
+			Logf:             func(string, ...interface{}) {},
+		}
+		if onChange != nil {
+			conf.OnChange = onChange(i)
+		}
+		node, err := Start(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { node.Shutdown() })
+		nodes[i] = node
+	}
+	for _, node := range nodes[1:] {
+		if _, err := node.Join(nodes[0].LocalAddr()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return nodes
+}
+
+//等待条件成立
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+//每个节点看到的存活成员数都等于want
+func converged(nodes []*Node, want int) func() bool {
+	return func() bool {
+		for _, node := range nodes {
+			if len(node.Members()) != want {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func TestJoinConverges(t *testing.T) {
+	nodes := startNodes(t, 5, nil)
+	//只通过第一个节点加入，其余成员依靠gossip互相发现
+	eventually(t, "all nodes to see each other", converged(nodes, 5))
+	if _, err := nodes[0].Join("127.0.0.1:1"); err == nil {
+		t.Fatal("joining through an unreachable seed should fail")
+	}
+}
+
+func TestFailureDetection(t *testing.T) {
+	nodes := startNodes(t, 4, nil)
+	eventually(t, "convergence", converged(nodes, 4))
+	//不通知其他成员直接停止，依靠探测和怀疑超时发现
+	nodes[3].Shutdown()
+	eventually(t, "the stopped node to be declared dead", converged(nodes[:3], 3))
+}
+
+func TestLeave(t *testing.T) {
+	nodes := startNodes(t, 4, nil)
+	eventually(t, "convergence", converged(nodes, 4))
+	start := time.Now()
+	if err := nodes[3].Leave(); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the leaving node to be removed", converged(nodes[:3], 3))
+	//主动离开不需要等待怀疑超时
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Fatalf("leave took %v to propagate", elapsed)
+	}
+}
+
+func TestRefuteSuspicion(t *testing.T) {
+	nodes := startNodes(t, 3, nil)
+	eventually(t, "convergence", converged(nodes, 3))
+	a, b := nodes[0], nodes[1]
+	//b错误地怀疑a，a收到后增加incarnation反驳
+	a.mu.Lock()
+	suspect := a.self
+	a.mu.Unlock()
+	suspect.State = StateSuspect
+	a.handle(&message{Type: msgGossip, From: b.conf.Name, Updates: []Member{suspect}}, b.LocalAddr())
+	eventually(t, "the refutation to reach b", func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		m := b.members[a.conf.Name]
+		return m != nil && m.State == StateAlive && m.Incarnation > suspect.Incarnation
+	})
+	if len(b.Members()) != 3 {
+		t.Fatal("refuted member should stay in the cluster")
+	}
+}
+
+func TestUpdatePool(t *testing.T) {
+	pools := make([]*ppcache.HTTPPool, 3)
+	for i := range pools {
+		pools[i] = ppcache.NewHTTPPool(fmt.Sprintf("http://127.0.0.1:%d", 18001+i))
+	}
+	nodes := startNodes(t, 3, func(i int) func(Member) { return UpdatePool(pools[i]) })
+	eventually(t, "pools to learn every peer", func() bool {
+		for _, pool := range pools {
+			if len(pool.Membership().Peers) != 3 {
+				return false
+			}
+		}
+		return true
+	})
+	nodes[2].Leave()
+	eventually(t, "pools to drop the leaving peer", func() bool {
+		return len(pools[0].Membership().Peers) == 2 && len(pools[1].Membership().Peers) == 2
+	})
+}
+
+func TestSignedGossip(t *testing.T) {
+	secret := [][]byte{[]byte("secret")}
+	nodes := startSecretNodes(t, 2, secret, nil)
+	eventually(t, "convergence", converged(nodes, 2))
+	a := nodes[0]
+
+	//密钥不同的节点无法加入
+	other, err := Start(Config{Name: "http://127.0.0.1:18099", BindAddr: "127.0.0.1:0", Secrets: [][]byte{[]byte("guess")}, Logf: func(string, ...interface{}) {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Shutdown()
+	if _, err := other.Join(a.LocalAddr()); err == nil {
+		t.Fatal("a node with the wrong secret should not be able to join")
+	}
+
+	//没有签名的消息被丢弃，不会加入成员
+	spoofed, _ := json.Marshal(&message{Type: msgGossip, From: "evil", Updates: []Member{{Name: "http://evil", Addr: "127.0.0.1:1"}}})
+	conn, err := net.Dial("udp", a.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write(spoofed)
+
+	//签名有效的消息只接受一次，时间窗口外的消息被拒绝
+	data, _ := json.Marshal(&message{Type: msgGossip, From: "b", Time: time.Now().UnixNano()})
+	packet := a.sealer.seal(data)
+	if _, err := a.decode(packet); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.decode(packet); err != errReplayed {
+		t.Fatalf("replayed message: got %v, want %v", err, errReplayed)
+	}
+	data, _ = json.Marshal(&message{Type: msgGossip, From: "b", Time: time.Now().Add(-time.Hour).UnixNano()})
+	if _, err := a.decode(a.sealer.seal(data)); err != errStale {
+		t.Fatalf("stale message: got %v, want %v", err, errStale)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	for _, m := range a.Members() {
+		if m.Name == "http://evil" || m.Name == other.conf.Name {
+			t.Fatalf("unauthenticated member %s joined", m.Name)
+		}
+	}
+}
+
+func TestPingReqUnknownTarget(t *testing.T) {
+	nodes := startNodes(t, 2, nil)
+	eventually(t, "convergence", converged(nodes, 2))
+	target, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	//不在成员列表中的目标，以及地址与成员不一致的目标都不会被探测
+	nodes[0].handle(&message{Type: msgPingReq, Seq: 1, Target: "http://victim", TargetAddr: target.LocalAddr().String()}, nodes[1].LocalAddr())
+	nodes[0].handle(&message{Type: msgPingReq, Seq: 2, Target: nodes[1].conf.Name, TargetAddr: target.LocalAddr().String()}, nodes[1].LocalAddr())
+	target.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	buf := make([]byte, maxPacketSize)
+	if n, _, err := target.ReadFrom(buf); err == nil {
+		t.Fatalf("ping-req reflected a %d byte message to an unknown address", n)
+	}
+}
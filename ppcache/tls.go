@@ -0,0 +1,214 @@
+// Package ppcache
+// @author    : MuXiang123
+// @time      : 2026/10/19 11:02
+// 节点间的TLS通信，证书可以在不重启的情况下从磁盘重新加载
+package ppcache
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TLSOptions 节点间TLS通信的配置
+type TLSOptions struct {
+	CertFile string //本节点的证书，同时作为服务端证书和客户端证书
+	KeyFile  string //证书对应的私钥
+	CAFile   string //校验对端证书使用的CA，为空时使用系统根证书
+
+	ClientAuth bool   //为true时服务端要求并校验客户端证书，只有持有CA签发证书的节点才能访问
+	ServerName string //校验服务端证书时使用的名称，为空时使用节点地址中的主机名或IP
+
+	ReloadInterval time.Duration //握手时检查证书文件是否变化的最小间隔，0表示只能通过ReloadCertificates重载
+}
+
+//某一时刻加载到内存中的证书
+type certSnapshot struct {
+	cert    *tls.Certificate
+	roots   *x509.CertPool //为nil时使用系统根证书
+	modTime time.Time      //证书文件中最新的修改时间
+}
+
+//可重载的证书存储，握手时总是读取最新的快照
+type certStore struct {
+	opts      TLSOptions
+	mu        sync.Mutex   //串行化重载
+	snapshot  atomic.Value //*certSnapshot
+	lastCheck int64        //上一次检查文件变化的时间，UnixNano
+}
+
+func newCertStore(o TLSOptions) *certStore {
+	s := &certStore{opts: o}
+	s.snapshot.Store(&certSnapshot{})
+	return s
+}
+
+func (s *certStore) load() *certSnapshot {
+	return s.snapshot.Load().(*certSnapshot)
+}
+
+//返回证书文件中最新的修改时间
+func (s *certStore) modTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{s.opts.CertFile, s.opts.KeyFile, s.opts.CAFile} {
+		if name == "" {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// reload 从磁盘读取证书，失败时保留原来的证书
+func (s *certStore) reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	modTime, err := s.modTime()
+	if err != nil {
+		return err
+	}
+	next := &certSnapshot{modTime: modTime}
+	if s.opts.CertFile != "" || s.opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.opts.CertFile, s.opts.KeyFile)
+		if err != nil {
+			return fmt.Errorf("loading key pair: %v", err)
+		}
+		next.cert = &cert
+	}
+	if s.opts.CAFile != "" {
+		pem, err := os.ReadFile(s.opts.CAFile)
+		if err != nil {
+			return fmt.Errorf("loading ca: %v", err)
+		}
+		next.roots = x509.NewCertPool()
+		if !next.roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", s.opts.CAFile)
+		}
+	}
+	s.snapshot.Store(next)
+	return nil
+}
+
+//到了检查间隔时，如果文件有变化就重新加载
+func (s *certStore) maybeReload() {
+	if s.opts.ReloadInterval <= 0 {
+		return
+	}
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&s.lastCheck)
+	if now-last < int64(s.opts.ReloadInterval) || !atomic.CompareAndSwapInt64(&s.lastCheck, last, now) {
+		return
+	}
+	modTime, err := s.modTime()
+	if err != nil || !modTime.After(s.load().modTime) {
+		return
+	}
+	_ = s.reload()
+}
+
+func (s *certStore) certificate() (*tls.Certificate, error) {
+	s.maybeReload()
+	if cert := s.load().cert; cert != nil {
+		return cert, nil
+	}
+	return nil, errors.New("ppcache: no tls certificate loaded")
+}
+
+//校验对端的证书链，roots为nil时使用系统根证书
+func (s *certStore) verify(certs []*x509.Certificate, name string, usage x509.ExtKeyUsage) error {
+	if len(certs) == 0 {
+		return errors.New("ppcache: peer presented no certificate")
+	}
+	opts := x509.VerifyOptions{
+		DNSName:       name,
+		Roots:         s.load().roots,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	}
+	for _, c := range certs[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	_, err := certs[0].Verify(opts)
+	return err
+}
+
+// serverConfig 服务端使用的tls配置
+func (s *certStore) serverConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return s.certificate()
+		},
+	}
+	if s.opts.ClientAuth {
+		//由VerifyConnection使用可重载的CA校验客户端证书
+		cfg.ClientAuth = tls.RequireAnyClientCert
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return s.verify(cs.PeerCertificates, "", x509.ExtKeyUsageClientAuth)
+		}
+	}
+	return cfg
+}
+
+// clientConfig 访问其他节点时使用的tls配置，name是校验服务端证书使用的主机名或IP
+func (s *certStore) clientConfig(name string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: name,
+		NextProtos: []string{"h2", "http/1.1"},
+		//跳过内置校验，由VerifyConnection使用可重载的CA完成同样的校验
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			return s.verify(cs.PeerCertificates, name, x509.ExtKeyUsageServerAuth)
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			s.maybeReload()
+			if cert := s.load().cert; cert != nil {
+				return cert, nil
+			}
+			//没有证书时发送空证书，由服务端决定是否拒绝
+			return &tls.Certificate{}, nil
+		},
+	}
+}
+
+//建立到addr的tls连接，配置了ServerName时按ServerName校验服务端证书，否则按addr中的主机名或IP校验
+//IP地址不会出现在SNI中，握手后的ConnectionState里没有名称，因此在拨号时确定校验的名称
+func (s *certStore) dialTLS(ctx context.Context, dialer *net.Dialer, network, addr string, timeout time.Duration) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	name := s.opts.ServerName
+	if name == "" {
+		name = host
+	}
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	tlsConn := tls.Client(conn, s.clientConfig(name))
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
@@ -0,0 +1,57 @@
+// Package ppcache
+// @author    : MuXiang123
+// @time      : 2026/10/19 13:57
+// 值的版本和CompareAndSet，用于乐观并发控制
+package ppcache
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// GetWithVersion 获取key对应的值和版本，版本由owner在加载或写入时分配，用于CompareAndSet
+// 从hotCache或副本读到的版本可能已经过时，这时CompareAndSet会返回ErrConflict
+func (g *Group) GetWithVersion(key string) (ByteView, uint64, error) {
+	v, err := g.Get(key)
+	if err != nil {
+		return ByteView{}, 0, err
+	}
+	return v, v.version, nil
+}
+
+// CompareAndSet 只有owner上key当前的版本等于version时才写入value，返回写入后的新版本
+// version为0表示key不在缓存中；版本不一致或key已经被淘汰时返回ErrConflict，
+// 调用方应该用GetWithVersion重新读取后再重试；owner是其他节点时发给owner比较和写入
+func (g *Group) CompareAndSet(key string, value []byte, version uint64) (uint64, error) {
+	if key == "" {
+		return 0, fmt.Errorf("key is require: %w", ErrBadRequest)
+	}
+	return g.set(context.Background(), key, g.newView(value), &version)
+}
+
+//分配新的版本，取当前的unix纳秒和上一个版本加一中较大的一个
+//本节点上单调递增，owner变化后新owner分配的版本通常也大于原owner分配的版本
+func (g *Group) nextVersion() uint64 {
+	for {
+		last := atomic.LoadUint64(&g.version)
+		next := uint64(time.Now().UnixNano())
+		if next <= last {
+			next = last + 1
+		}
+		if atomic.CompareAndSwapUint64(&g.version, last, next) {
+			return next
+		}
+	}
+}
+
+//保存其他节点分配的版本时调用，保证本节点之后成为owner时分配的版本更大
+func (g *Group) observeVersion(version uint64) {
+	for {
+		last := atomic.LoadUint64(&g.version)
+		if version <= last || atomic.CompareAndSwapUint64(&g.version, last, version) {
+			return
+		}
+	}
+}